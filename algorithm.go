@@ -0,0 +1,114 @@
+package goresolver
+
+import (
+	"log"
+
+	"github.com/miekg/dns"
+)
+
+// AlgorithmSupport is the policy of a Resolver for a DNSSEC algorithm.
+type AlgorithmSupport int
+
+const (
+	// AlgorithmUnsupported algorithms are not validated.  Zones whose DS
+	// RRs only reference unsupported algorithms are treated as insecure
+	// (RFC 6840 section 5.2).
+	AlgorithmUnsupported AlgorithmSupport = iota
+	// AlgorithmSupported algorithms are validated.
+	AlgorithmSupported
+	// AlgorithmDisallowed algorithms are rejected: zones whose DS RRs
+	// only reference unsupported or disallowed algorithms are bogus.
+	AlgorithmDisallowed
+)
+
+// verifiableAlgorithms are the DNSSEC algorithms github.com/miekg/dns can
+// verify.  Ed448 (RFC 8080) is not one of them, and the standard library
+// has no implementation of it, so Ed448 signatures are never validated.
+var verifiableAlgorithms = map[uint8]bool{
+	dns.RSASHA1:          true,
+	dns.RSASHA1NSEC3SHA1: true,
+	dns.RSASHA256:        true,
+	dns.RSASHA512:        true,
+	dns.ECDSAP256SHA256:  true,
+	dns.ECDSAP384SHA384:  true,
+	dns.ED25519:          true,
+}
+
+// DefaultAlgorithmPolicy returns the default algorithm policy, following
+// the validation recommendations of RFC 8624 section 3.1.  RSAMD5 and
+// DSA are disallowed.  ECC-GOST and Ed448 cannot be verified, so zones
+// signed with them are insecure, although RFC 8624 recommends validating
+// Ed448; it can't be set to AlgorithmSupported.  Algorithms missing from
+// the policy are unsupported.
+func DefaultAlgorithmPolicy() map[uint8]AlgorithmSupport {
+	return map[uint8]AlgorithmSupport{
+		dns.RSAMD5:           AlgorithmDisallowed,
+		dns.DSA:              AlgorithmDisallowed,
+		dns.RSASHA1:          AlgorithmSupported,
+		dns.DSANSEC3SHA1:     AlgorithmDisallowed,
+		dns.RSASHA1NSEC3SHA1: AlgorithmSupported,
+		dns.RSASHA256:        AlgorithmSupported,
+		dns.RSASHA512:        AlgorithmSupported,
+		dns.ECCGOST:          AlgorithmUnsupported,
+		dns.ECDSAP256SHA256:  AlgorithmSupported,
+		dns.ECDSAP384SHA384:  AlgorithmSupported,
+		dns.ED25519:          AlgorithmSupported,
+		dns.ED448:            AlgorithmUnsupported,
+	}
+}
+
+// SetAlgorithmPolicy sets the DNSSEC algorithms the resolver validates,
+// treats as insecure or rejects.  It returns ErrUnsupportedAlgorithm if
+// an algorithm that cannot be verified is set to AlgorithmSupported.
+// The policy is only used if resolver is the package Resolver instance.
+func (resolver *Resolver) SetAlgorithmPolicy(policy map[uint8]AlgorithmSupport) error {
+	algorithms := make(map[uint8]AlgorithmSupport, len(policy))
+	for algorithm, support := range policy {
+		if support == AlgorithmSupported && !verifiableAlgorithms[algorithm] {
+			return ErrUnsupportedAlgorithm
+		}
+		algorithms[algorithm] = support
+	}
+	resolver.algorithms = algorithms
+	return nil
+}
+
+// algorithmSupport returns the policy of the resolver for algorithm.
+func (resolver *Resolver) algorithmSupport(algorithm uint8) AlgorithmSupport {
+	return resolver.algorithms[algorithm]
+}
+
+// checkAlgorithmSupport returns nil if algorithm is supported, and the
+// error of signatures made with it otherwise.
+func checkAlgorithmSupport(algorithm uint8) error {
+	switch resolver.algorithmSupport(algorithm) {
+	case AlgorithmSupported:
+		return nil
+	case AlgorithmDisallowed:
+		return ErrDisallowedAlgorithm
+	}
+	return ErrUnsupportedAlgorithm
+}
+
+// checkDsAlgorithms checks that the DS RRs of a delegation reference a
+// supported algorithm with a supported digest type.  It returns
+// ErrInsecureDelegation if they only reference unsupported algorithms or
+// digest types (RFC 6840 section 5.2), and ErrDisallowedAlgorithm if they
+// also reference disallowed algorithms.
+func checkDsAlgorithms(dsRrset []dns.RR) error {
+	err := ErrInsecureDelegation
+	for _, rr := range dsRrset {
+		ds, ok := rr.(*dns.DS)
+		if !ok || !resolver.dsDigestTypes[ds.DigestType] {
+			continue
+		}
+		switch resolver.algorithmSupport(ds.Algorithm) {
+		case AlgorithmSupported:
+			return nil
+		case AlgorithmDisallowed:
+			err = ErrDisallowedAlgorithm
+		}
+	}
+	log.Printf("DS RRs don't reference a supported algorithm: %s\n", err)
+	return err
+}
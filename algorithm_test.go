@@ -0,0 +1,98 @@
+package goresolver
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestAlgorithmEd25519(t *testing.T) {
+	n := newSignedTestNet(t)
+	n.rekey("example.org.", dns.ED25519)
+	resolver := n.newResolver()
+
+	result, err := resolver.LookupIPv4("www.example.org.")
+	if err != nil || result.Status != Secure {
+		t.Error("Ed25519 zones should validate: ", err)
+	}
+	if _, err := resolver.StrictNSQuery("nonexistent.example.org.", dns.TypeA); !errors.Is(err, ErrNxDomain) {
+		t.Error("Ed25519 denials should validate: ", err)
+	}
+}
+
+func TestAlgorithmRSA(t *testing.T) {
+	n := newSignedTestNet(t)
+	n.rekey("example.org.", dns.RSASHA256)
+	resolver := n.newResolver()
+
+	if _, err := resolver.LookupIPv4("www.example.org."); err != nil {
+		t.Error("RSASHA256 zones should validate: ", err)
+	}
+}
+
+func TestAlgorithmUnsupportedInsecure(t *testing.T) {
+	n := newSignedTestNet(t)
+	n.rekey("example.org.", dns.ECDSAP384SHA384)
+	resolver := n.newResolver()
+	policy := DefaultAlgorithmPolicy()
+	policy[dns.ECDSAP384SHA384] = AlgorithmUnsupported
+	if err := resolver.SetAlgorithmPolicy(policy); err != nil {
+		t.Fatal("shouldn't return err: ", err)
+	}
+
+	result, err := resolver.LookupIPv4("www.example.org.")
+	if err != nil || result.Status != Insecure {
+		t.Error("zones with unsupported algorithms should be insecure: ", err)
+	}
+	if len(result.IPs()) != 1 {
+		t.Error("lookup should return results")
+	}
+}
+
+func TestAlgorithmDisallowed(t *testing.T) {
+	n := newSignedTestNet(t)
+	n.rekey("example.org.", dns.ECDSAP384SHA384)
+	resolver := n.newResolver()
+	policy := DefaultAlgorithmPolicy()
+	policy[dns.ECDSAP384SHA384] = AlgorithmDisallowed
+	_ = resolver.SetAlgorithmPolicy(policy)
+
+	result, err := resolver.LookupIPv4("www.example.org.")
+	if !errors.Is(err, ErrDisallowedAlgorithm) || result.Status != Bogus {
+		t.Error("zones with disallowed algorithms should be bogus: ", err)
+	}
+	if result.ExtendedError == nil || result.ExtendedError.InfoCode != EDEUnsupportedDnskeyAlgorithm {
+		t.Error("should return Unsupported DNSKEY Algorithm: ", result.ExtendedError)
+	}
+}
+
+func TestAlgorithmUnsupportedSignatureInSecureZone(t *testing.T) {
+	n := newSignedTestNet(t)
+	example := n.zones["example.org."]
+	key, signer := n.newKeyAlgorithm("example.org.", 256, dns.ECDSAP384SHA384)
+	example.rrs = append(example.rrs, key)
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "www.example.org." && qtype == dns.TypeA {
+			msg.Answer = []dns.RR{msg.Answer[0], example.sign(t, msg.Answer[:1], key, signer)}
+		}
+	}
+	resolver := n.newResolver()
+	policy := DefaultAlgorithmPolicy()
+	policy[dns.ECDSAP384SHA384] = AlgorithmUnsupported
+	_ = resolver.SetAlgorithmPolicy(policy)
+
+	_, err := resolver.LookupIPv4("www.example.org.")
+	if !errors.Is(err, ErrInvalidRRsig) || !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Error("only supported signatures should validate a secure zone: ", err)
+	}
+}
+
+func TestSetAlgorithmPolicyInvalid(t *testing.T) {
+	resolver := newSignedTestNet(t).newResolver()
+	policy := DefaultAlgorithmPolicy()
+	policy[dns.ED448] = AlgorithmSupported
+	if resolver.SetAlgorithmPolicy(policy) != ErrUnsupportedAlgorithm {
+		t.Error("should reject algorithms that cannot be verified")
+	}
+}
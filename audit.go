@@ -0,0 +1,149 @@
+package goresolver
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// SignatureValidity describes the validity period of a recorded RRSIG at
+// the time of an audit.
+type SignatureValidity struct {
+	RRSIG      *dns.RRSIG
+	Inception  time.Time
+	Expiration time.Time
+	// Err is nil if the signature was within its validity period, and
+	// ErrRrsigExpired or ErrRrsigNotYetValid otherwise.
+	Err error
+}
+
+// AuditResult holds the result of validating recorded RRs at a given
+// time, along with the validity of each recorded RRSIG at that time.
+type AuditResult struct {
+	Result
+	Signatures []SignatureValidity
+}
+
+// VerifyAt validates the qtype RRset of qname in the recorded records as
+// of the time at, e.g. to find out whether an answer would have
+// validated during an incident.  records has to hold the answer, the
+// DNSKEY and DS RRsets of the zones up to a trust anchor of the resolver,
+// the NSEC or NSEC3 records proving the absence of DS RRsets, and their
+// RRSIGs; no queries are sent.  The signature time skew of the
+// resolver applies, negative trust anchors don't.
+func (resolver *Resolver) VerifyAt(qname string, qtype uint16, records []dns.RR, at time.Time) (result *AuditResult, err error) {
+
+	result = &AuditResult{Signatures: signatureValidity(records, at, resolver.skew)}
+	defer func() {
+		err = lookupError(result.Status, err)
+		result.ExtendedError = extendedError(result.Status, err)
+	}()
+	if len(qname) < 1 {
+		return result, ErrInvalidQuery
+	}
+
+	rrSets, _ := groupRRsets(records)
+	answer, ok := rrSets[rrsetKey{canonicalName(qname), dns.ClassINET, qtype}]
+	if !ok {
+		return result, ErrNoResult
+	}
+
+	delegation := func(zone string) (*SignedZone, error) {
+		signedZone := NewSignedZone(zone)
+		signedZone.now = func() time.Time { return at }
+		signedZone.skew = resolver.skew
+		if dnskey, ok := rrSets[rrsetKey{canonicalName(zone), dns.ClassINET, dns.TypeDNSKEY}]; ok {
+			signedZone.dnskey = dnskey
+		}
+		signedZone.pubKeyLookup = make(map[uint16][]*dns.DNSKEY)
+		for _, rr := range signedZone.dnskey.rrSet {
+			signedZone.addPubKey(rr.(*dns.DNSKEY))
+		}
+		if ds, ok := rrSets[rrsetKey{canonicalName(zone), dns.ClassINET, dns.TypeDS}]; ok {
+			signedZone.ds = ds
+		} else {
+			// An empty DS RRset keeps the recorded NSEC or NSEC3 records
+			// of the parent, which have to prove that the zone is not
+			// signed.
+			signer := recordedParent(rrSets, zone)
+			for _, denial := range denialRRsets(records) {
+				if denial.IsSigned() && canonicalName(denial.SignerName()) == signer {
+					signedZone.ds.denial = append(signedZone.ds.denial, denial)
+				}
+			}
+		}
+		return signedZone, nil
+	}
+
+	authChain := NewAuthenticationChain()
+	if !answer.IsSigned() {
+		err = authChain.populate(qname, delegation)
+		if err != nil {
+			return result, err
+		}
+		result.Status, err = authChain.VerifyInsecure()
+		if err == ErrInsecureDelegation {
+			result.RRs = answer.rrSet
+		}
+		return result, err
+	}
+
+	// The NSEC or NSEC3 records of the signer prove wildcard expansions.
+	for _, denial := range denialRRsets(records) {
+		if denial.IsSigned() && canonicalName(denial.SignerName()) == canonicalName(answer.SignerName()) {
+			answer.denial = append(answer.denial, denial)
+		}
+	}
+	err = authChain.populate(answer.SignerName(), delegation)
+	if err != nil {
+		return result, err
+	}
+	result.Status, err = authChain.Verify(answer)
+	if result.Status != Secure && result.Status != Insecure {
+		log.Printf("DNSSEC validation at %s failed: %s\n", at, err)
+		return result, err
+	}
+
+	result.addVerifiedAnswer(authChain, answer)
+	return result, err
+}
+
+// recordedParent returns the closest zone above zone with a recorded
+// DNSKEY RRset, or the root zone.
+func recordedParent(rrSets map[rrsetKey]*RRSet, zone string) string {
+	labels := dns.SplitDomainName(zone)
+	for i := 1; i < len(labels); i++ {
+		parent := canonicalName(dns.Fqdn(strings.Join(labels[i:], ".")))
+		if _, ok := rrSets[rrsetKey{parent, dns.ClassINET, dns.TypeDNSKEY}]; ok {
+			return parent
+		}
+	}
+	return "."
+}
+
+// signatureValidity returns the validity of each RRSIG in records at
+// the time at.
+func signatureValidity(records []dns.RR, at time.Time, skew time.Duration) []SignatureValidity {
+	signatures := make([]SignatureValidity, 0)
+	for _, rr := range records {
+		rrSig, ok := rr.(*dns.RRSIG)
+		if !ok {
+			continue
+		}
+		signatures = append(signatures, SignatureValidity{
+			RRSIG:      rrSig,
+			Inception:  signatureTime(rrSig.Inception, at),
+			Expiration: signatureTime(rrSig.Expiration, at),
+			Err:        validityPeriodError(rrSig, at, skew),
+		})
+	}
+	return signatures
+}
+
+// signatureTime converts an RRSIG timestamp to the time closest to ref,
+// using serial number arithmetic (RFC 4034 section 3.1.5).
+func signatureTime(t uint32, ref time.Time) time.Time {
+	return time.Unix(ref.Unix()+int64(int32(t-uint32(ref.Unix()))), 0).UTC()
+}
@@ -0,0 +1,107 @@
+package goresolver
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// recordedRRs returns the RRs of the fixture files of a test.
+func recordedRRs(t *testing.T, testName string) []dns.RR {
+	files, err := filepath.Glob(filepath.Join("./testdata", testName, "*.txt"))
+	if err != nil || len(files) < 1 {
+		t.Fatal("cannot find fixtures", err)
+	}
+	rrs := make([]dns.RR, 0)
+	for _, file := range files {
+		s, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal("cannot read fixture", err)
+		}
+		for _, rrStr := range strings.Split(string(s), "\n") {
+			if rrStr == "" {
+				continue
+			}
+			rr, err := dns.NewRR(rrStr)
+			if err != nil {
+				t.Fatal("cannot parse RR", err)
+			}
+			rrs = append(rrs, rr)
+		}
+	}
+	return rrs
+}
+
+func TestVerifyAt(t *testing.T) {
+	resolver, _ := NewResolver("./testdata/resolv.conf")
+	records := recordedRRs(t, "TestLookupValid1")
+
+	result, err := resolver.VerifyAt("stakey.org.", dns.TypeA, records, fixtureTime)
+	if err != nil || result.Status != Secure {
+		t.Error("recorded answer should validate at the time it was recorded: ", err)
+	}
+	if len(result.RRs) < 1 {
+		t.Error("VerifyAt should return the validated RRs")
+	}
+	if len(result.Signatures) < 1 {
+		t.Fatal("VerifyAt should report the recorded signatures")
+	}
+	for _, sig := range result.Signatures {
+		if sig.Err != nil || !sig.Inception.Before(fixtureTime) || !sig.Expiration.After(fixtureTime) {
+			t.Error("signature should be within its validity period: ", sig.RRSIG)
+		}
+	}
+
+	result, err = resolver.VerifyAt("stakey.org.", dns.TypeA, records, time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC))
+	if !errors.Is(err, ErrRrsigExpired) || result.Status != Bogus || len(result.RRs) > 0 {
+		t.Error("recorded answer shouldn't validate after the signatures expired: ", err)
+	}
+	for _, sig := range result.Signatures {
+		if sig.Err != ErrRrsigExpired {
+			t.Error("signature should be reported expired: ", sig.RRSIG)
+		}
+	}
+}
+
+func TestVerifyAtMissingAnswer(t *testing.T) {
+	resolver, _ := NewResolver("./testdata/resolv.conf")
+
+	_, err := resolver.VerifyAt("stakey.org.", dns.TypeMX, recordedRRs(t, "TestLookupValid1"), fixtureTime)
+	if err != ErrNoResult {
+		t.Error("should return ErrNoResult: ", err)
+	}
+}
+
+func TestVerifyAtInsecureDelegation(t *testing.T) {
+	n := newInsecureTestNet(t)
+	resolver := n.newResolver()
+
+	// The answer and the chain of trust, as recorded by a resolver.
+	records := make([]dns.RR, 0)
+	for _, q := range []struct {
+		qname string
+		qtype uint16
+	}{
+		{"www.unsigned.org.", dns.TypeA},
+		{"unsigned.org.", dns.TypeDS},
+		{"org.", dns.TypeDNSKEY},
+		{"org.", dns.TypeDS},
+		{".", dns.TypeDNSKEY},
+	} {
+		msg, err := n.query(q.qname, q.qtype)
+		if err != nil {
+			t.Fatal("cannot record answer: ", err)
+		}
+		records = append(append(records, msg.Answer...), msg.Ns...)
+	}
+
+	result, _ := resolver.VerifyAt("www.unsigned.org.", dns.TypeA, records, time.Now())
+	if result.Status != Insecure || len(result.RRs) != 1 {
+		t.Error("recorded answer of a proven insecure delegation should be insecure: ", result.Status)
+	}
+}
@@ -1,9 +1,11 @@
 package goresolver
 
 import (
-	"github.com/miekg/dns"
+	"errors"
 	"log"
 	"strings"
+
+	"github.com/miekg/dns"
 )
 
 // AuthenticationChain represents the DNSSEC chain of trust from the
@@ -18,28 +20,35 @@ type AuthenticationChain struct {
 
 // Populate queries the RRs required for the zone validation
 // It begins the queries at the *domainName* zone and then walks
-// up the delegation tree all the way up to the root zone, thus
-// populating a linked list of SignedZone objects.
+// up the delegation tree towards the root zone, thus populating
+// a linked list of SignedZone objects.  The walk stops at the first
+// zone that has a trust anchor configured.
 func (authChain *AuthenticationChain) Populate(domainName string) error {
+	return authChain.populate(domainName, queryDelegation)
+}
 
-	qnameComponents := strings.Split(domainName, ".")
-	zonesToVerify := len(qnameComponents)
-	// TODO add test case
-	if zonesToVerify < 0 {
-		zonesToVerify = 0
-	}
+// populate builds the delegationChain of domainName the same way
+// Populate does, fetching the DS and DNSKEY records of each zone
+// with delegation.
+func (authChain *AuthenticationChain) populate(domainName string, delegation func(string) (*SignedZone, error)) error {
+
+	qnameComponents := dns.SplitDomainName(domainName)
+	zonesToVerify := len(qnameComponents) + 1
 
 	authChain.delegationChain = make([]SignedZone, 0, zonesToVerify)
 	for i := 0; i < zonesToVerify; i++ {
 		zoneName := dns.Fqdn(strings.Join(qnameComponents[i:], "."))
-		delegation, err := queryDelegation(zoneName)
+		signedZone, err := delegation(zoneName)
 		if err != nil {
 			return err
 		}
 		if i > 0 {
-			authChain.delegationChain[i-1].parentZone = delegation
+			authChain.delegationChain[i-1].parentZone = signedZone
+		}
+		authChain.delegationChain = append(authChain.delegationChain, *signedZone)
+		if resolver.hasTrustAnchor(zoneName) {
+			break
 		}
-		authChain.delegationChain = append(authChain.delegationChain, *delegation)
 	}
 	return nil
 }
@@ -51,53 +60,302 @@ func (authChain *AuthenticationChain) Populate(domainName string) error {
 // valid, it walks through the delegationChain checking the RRSIGs on
 // the DNSKEY and DS resource record sets, as well as correctness of each
 // delegation using the lower level methods in SignedZone.
-func (authChain *AuthenticationChain) Verify(answerRRset *RRSet) error {
+// The DNSKEY RRset of the zone at the top of the chain has to match
+// one of the trust anchors configured for that zone.
+// Verify returns the validation status of the answer along with the
+// validation error, a *ValidationError describing the failure.  If the
+// chain of trust ends at a provably insecure delegation, the status is
+// Insecure and the error is ErrInsecureDelegation, whether the answer
+// verifies or not.  The answer has to be signed by the zone the chain
+// was populated for, which has to be its owner name or an ancestor of
+// it; other signers are bogus.
+func (authChain *AuthenticationChain) Verify(answerRRset *RRSet) (ValidationStatus, error) {
+
+	// The chain of trust of another zone than the signer of the answer
+	// can't make it insecure.
+	err := authChain.verifySignerName(answerRRset)
+	if err != nil {
+		return validationStatus(err), err
+	}
+
+	err = authChain.verifyAnswer(answerRRset)
+	if err == nil {
+		err = authChain.verifyWildcard(answerRRset)
+	}
+	if err != nil {
+		// The signatures in an insecure zone don't matter.
+		if _, chainErr := authChain.verifyChain(); chainErr == ErrInsecureDelegation {
+			err = chainErr
+		}
+		return validationStatus(err), err
+	}
+
+	_, err = authChain.verifySigner()
+	return validationStatus(err), err
+}
+
+// verifySignerName checks that the answer is signed by the first zone
+// in the delegationChain, which has to be the owner name of the answer or
+// one of its ancestors (RFC 4035 section 5.3.1).
+func (authChain *AuthenticationChain) verifySignerName(answerRRset *RRSet) error {
+
+	if !answerRRset.IsSigned() || answerRRset.IsEmpty() {
+		return nil
+	}
+	signedZone := authChain.delegationChain[0]
+	signerName := answerRRset.SignerName()
+	owner := answerRRset.rrSet[0].Header().Name
+	if canonicalName(signerName) != canonicalName(signedZone.zone) || !dns.IsSubDomain(signerName, owner) {
+		log.Printf("%s cannot be signed by %s\n", owner, signerName)
+		return newValidationError(ErrInvalidRRsig, signedZone.zone, 0, answerRRset, ErrInvalidSignerName)
+	}
+	return nil
+}
+
+// verifyAnswer verifies the RRSIG on the answer RRs with the keys of the
+// first zone in the delegationChain.
+func (authChain *AuthenticationChain) verifyAnswer(answerRRset *RRSet) error {
 
 	signedZone := authChain.delegationChain[0]
 	if !signedZone.checkHasDnskeys() {
-		return ErrDnskeyNotAvailable
+		return newValidationError(ErrDnskeyNotAvailable, signedZone.zone, 0, answerRRset, nil)
 	}
 
 	err := signedZone.verifyRRSIG(answerRRset)
 	if err != nil {
 		log.Println("RRSIG didn't verify", err)
-		return ErrInvalidRRsig
+		return newValidationError(ErrInvalidRRsig, signedZone.zone, 0, answerRRset, err)
 	}
+	return nil
+}
 
-	for _, signedZone := range authChain.delegationChain {
+// verifyWildcard checks that an answer synthesized from a wildcard comes
+// with the NSEC or NSEC3 records of the first zone in the delegationChain
+// proving that no closer match for the owner name exists.
+func (authChain *AuthenticationChain) verifyWildcard(answerRRset *RRSet) error {
 
-		if signedZone.dnskey.IsEmpty() {
-			log.Printf("DNSKEY RR does not exist on %s\n", signedZone.zone)
-			return ErrDnskeyNotAvailable
+	closestEncloser, ok := answerRRset.wildcardExpansion()
+	if !ok {
+		return nil
+	}
+	signedZone := authChain.delegationChain[0]
+	qname := answerRRset.rrSet[0].Header().Name
+	log.Printf("%s was synthesized from the wildcard at %s\n", qname, closestEncloser)
+
+	if !dns.IsSubDomain(signedZone.zone, closestEncloser) {
+		return newValidationError(ErrInvalidRRsig, signedZone.zone, 0, answerRRset, ErrInvalidRrsigLabels)
+	}
+	if len(answerRRset.denial) < 1 {
+		return newValidationError(ErrNoDenialProof, signedZone.zone, 0, answerRRset, nil)
+	}
+	records, err := signedZone.verifyNSEC(answerRRset.denial)
+	if err == nil {
+		err = records.verifyWildcardExpansion(qname, closestEncloser)
+		if err != nil && err != ErrInsecureDelegation {
+			err = newValidationError(err, signedZone.zone, 0, answerRRset.denial[0], nil)
 		}
+	}
+	return err
+}
 
-		// Verify the RRSIG of the DNSKEY RRset with the public KSK.
-		err := signedZone.verifyRRSIG(signedZone.dnskey)
-		if err != nil {
-			log.Printf("validation DNSKEY: %s\n", err)
-			return ErrRrsigValidationError
+// VerifyNameError validates a denial of existence of qname (NXDOMAIN).
+// It validates the chain of trust the same way Verify does, verifies
+// the RRSIGs on the NSEC or NSEC3 RRsets of the denial with the keys of
+// the first zone in the delegationChain, and checks that the records
+// prove that neither qname nor a wildcard matching it exists.
+// It returns the validation status of the denial along with the
+// validation error.
+func (authChain *AuthenticationChain) VerifyNameError(qname string, denial []*RRSet) (ValidationStatus, error) {
+	return authChain.verifyDenial(denial, func(records *denialRecords) error {
+		return records.verifyNameError(qname)
+	})
+}
+
+// VerifyNoData validates a denial of existence of the qtype RRset at
+// qname (NODATA), the same way VerifyNameError does for NXDOMAIN.  The
+// NSEC or NSEC3 matching qname has to prove that neither qtype nor a
+// CNAME exists at qname.
+func (authChain *AuthenticationChain) VerifyNoData(qname string, qtype uint16, denial []*RRSet) (ValidationStatus, error) {
+	return authChain.verifyDenial(denial, func(records *denialRecords) error {
+		return records.verifyNoData(qname, qtype)
+	})
+}
+
+// VerifyInsecure validates that unsigned answers for the name the chain
+// was populated for are legitimate.  It returns ErrInsecureDelegation if
+// the chain of trust ends at a provably insecure delegation, and
+// ErrResourceNotSigned if the name belongs to a secure zone, along with
+// the validation status of the unsigned answers.
+func (authChain *AuthenticationChain) VerifyInsecure() (ValidationStatus, error) {
+	_, err := authChain.verifyChain()
+	if err == nil {
+		log.Printf("%s is in a secure zone\n", authChain.delegationChain[0].zone)
+		err = ErrResourceNotSigned
+	}
+	return validationStatus(err), err
+}
+
+// verifyDenial validates the chain of trust, verifies the NSEC or NSEC3
+// RRsets of a denial of existence and checks the records with proof.
+func (authChain *AuthenticationChain) verifyDenial(denial []*RRSet, proof func(*denialRecords) error) (ValidationStatus, error) {
+
+	if len(denial) < 1 {
+		return Bogus, ErrNoDenialProof
+	}
+
+	signedZone, err := authChain.verifySigner()
+	if err != nil {
+		return validationStatus(err), err
+	}
+
+	records, err := signedZone.verifyNSEC(denial)
+	if err == nil {
+		err = proof(records)
+		if err != nil && err != ErrInsecureDelegation {
+			err = newValidationError(err, signedZone.zone, 0, denial[0], nil)
 		}
+	}
+	return validationStatus(err), err
+}
 
-		if signedZone.parentZone != nil {
+// verifySigner validates the chain of trust, and returns the first zone
+// in the delegationChain, which signed the RRs to verify, if it is
+// secure.
+func (authChain *AuthenticationChain) verifySigner() (*SignedZone, error) {
 
-			if signedZone.ds.IsEmpty() {
-				log.Printf("DS RR is not available on zoneName %s\n", signedZone.zone)
-				return ErrDsNotAvailable
-			}
+	secureZone, err := authChain.verifyChain()
+	if err != nil {
+		return nil, err
+	}
 
-			err := signedZone.parentZone.verifyRRSIG(signedZone.ds)
-			if err != nil {
-				log.Printf("DS on %s doesn't validate against RRSIG %d\n", signedZone.zone, signedZone.ds.rrSig.KeyTag)
-				return ErrRrsigValidationError
+	signedZone := &authChain.delegationChain[0]
+	if secureZone != signedZone {
+		log.Printf("%s is not a zone\n", signedZone.zone)
+		return nil, newValidationError(ErrDsNotAvailable, signedZone.zone, 0, nil, nil)
+	}
+	if !signedZone.checkHasDnskeys() {
+		return nil, newValidationError(ErrDnskeyNotAvailable, signedZone.zone, 0, nil, nil)
+	}
+	return signedZone, nil
+}
+
+// verifyChain walks down the delegationChain from the trust anchor,
+// checking the RRSIGs on the DNSKEY and DS resource record sets of each
+// zone and the delegations between them.  It returns the lowest secure
+// zone of the chain.
+// A name in the chain without DS RRs has to be proven, by a signed
+// denial of existence from the secure zone above it, to be either no
+// zone cut, or an insecure delegation, in which case the walk stops
+// with ErrInsecureDelegation.  Unproven absence of DS RRs returns
+// ErrDsNotAvailable.  Validation failures are returned as
+// *ValidationError.
+func (authChain *AuthenticationChain) verifyChain() (*SignedZone, error) {
+
+	top := len(authChain.delegationChain) - 1
+	secure := top
+	secureZone := &authChain.delegationChain[top]
+
+	anchors := resolver.zoneTrustAnchors(secureZone.zone)
+	if len(anchors) < 1 {
+		log.Printf("no trust anchor for %s\n", secureZone.zone)
+		return nil, newValidationError(ErrNoTrustAnchor, secureZone.zone, top, nil, nil)
+	}
+
+	if secureZone.dnskey.IsEmpty() {
+		log.Printf("DNSKEY RR does not exist on %s\n", secureZone.zone)
+		return nil, dnskeyNotAvailable(secureZone.zone, top)
+	}
+
+	// The top of the chain has to be signed by a key matching a trust
+	// anchor.
+	err := secureZone.verifyTrustAnchor(anchors)
+	if err == ErrTrustAnchorMismatch {
+		log.Printf("DNSKEY on %s does not match the trust anchor\n", secureZone.zone)
+		return nil, newValidationError(err, secureZone.zone, top, secureZone.dnskey, nil)
+	}
+	if err != nil {
+		log.Printf("validation DNSKEY: %s\n", err)
+		return nil, newValidationError(ErrRrsigValidationError, secureZone.zone, top, secureZone.dnskey, err)
+	}
+
+	for i := top - 1; i >= 0; i-- {
+
+		signedZone := &authChain.delegationChain[i]
+
+		if signedZone.ds.IsEmpty() {
+			err := secureZone.verifyMissingDS(signedZone.zone, signedZone.ds)
+			if err == ErrInsecureDelegation {
+				log.Printf("%s is an insecure delegation\n", signedZone.zone)
+				return nil, err
 			}
-			err = signedZone.verifyDS(signedZone.ds.rrSet)
 			if err != nil {
-				log.Printf("DS does not validate: %s", err)
-				return ErrDsInvalid
+				log.Printf("DS RR is not available on zoneName %s\n", signedZone.zone)
+				// The denial of existence was checked in the secure zone.
+				var denialErr *ValidationError
+				if errors.As(err, &denialErr) {
+					denialErr.Position = secure
+				}
+				dsErr := newValidationError(ErrDsNotAvailable, signedZone.zone, i, nil, err)
+				dsErr.RRType = dns.TypeDS
+				return nil, dsErr
 			}
+			continue
+		}
+
+		err := secureZone.verifyRRSIG(signedZone.ds)
+		if err != nil {
+			log.Printf("DS on %s doesn't validate against RRSIG: %s\n", signedZone.zone, err)
+			return nil, newValidationError(ErrRrsigValidationError, signedZone.zone, i, signedZone.ds, err)
+		}
+
+		// Zones signed only with unsupported algorithms are insecure.
+		err = checkDsAlgorithms(signedZone.ds.rrSet)
+		if err == ErrInsecureDelegation {
+			log.Printf("%s is signed with unsupported algorithms\n", signedZone.zone)
+			return nil, err
+		}
+		if err != nil {
+			return nil, dsValidationError(err, signedZone, i, nil)
+		}
+
+		if signedZone.dnskey.IsEmpty() {
+			log.Printf("DNSKEY RR does not exist on %s\n", signedZone.zone)
+			return nil, dnskeyNotAvailable(signedZone.zone, i)
+		}
+
+		// The DNSKEY RRset has to be signed by a key matching a DS RR.
+		err = signedZone.verifyDS(signedZone.ds.rrSet)
+		if err != nil && !isDsMismatch(err) {
+			log.Printf("validation DNSKEY: %s\n", err)
+			return nil, newValidationError(ErrRrsigValidationError, signedZone.zone, i, signedZone.dnskey, err)
+		}
+		if err != nil {
+			log.Printf("DS does not validate: %s", err)
+			return nil, dsValidationError(ErrDsInvalid, signedZone, i, err)
 		}
+		secure, secureZone = i, signedZone
 	}
-	return nil
+	return secureZone, nil
+}
+
+// dsValidationError returns the ValidationError for the DS RRset of the
+// zone at position in the delegation chain, taking the key tag and
+// algorithm from its first DS RR.
+func dsValidationError(reason error, signedZone *SignedZone, position int, err error) *ValidationError {
+	dsErr := newValidationError(reason, signedZone.zone, position, nil, err)
+	dsErr.RRType = dns.TypeDS
+	if ds, ok := signedZone.ds.rrSet[0].(*dns.DS); ok {
+		dsErr.KeyTag, dsErr.Algorithm = ds.KeyTag, ds.Algorithm
+	}
+	return dsErr
+}
+
+// dnskeyNotAvailable returns the ValidationError for a zone at position
+// in the delegation chain without DNSKEY RRs.
+func dnskeyNotAvailable(zone string, position int) *ValidationError {
+	err := newValidationError(ErrDnskeyNotAvailable, zone, position, nil, nil)
+	err.RRType = dns.TypeDNSKEY
+	return err
 }
 
 // NewAuthenticationChain initializes an AuthenticationChain object and
@@ -0,0 +1,186 @@
+package goresolver
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func newInsecureTestNet(t *testing.T) *testNet {
+	n := newSignedTestNet(t)
+	unsigned := n.addUnsignedZone("unsigned.org.")
+	unsigned.add(t, "www.unsigned.org. 300 IN A 192.0.2.4")
+	return n
+}
+
+func TestInsecureDelegationProven(t *testing.T) {
+	resolver := newInsecureTestNet(t).newResolver()
+
+	result, err := resolver.LookupIPv4("www.unsigned.org.")
+	if err != nil || result.Status != Insecure {
+		t.Error("should be insecure: ", err)
+	}
+	if len(result.IPs()) != 1 {
+		t.Error("lookup should return results")
+	}
+	result, err = resolver.LookupIP("www.unsigned.org.")
+	if err != nil || result.Status != Insecure || len(result.IPs()) != 1 {
+		t.Error("should return insecure results: ", err)
+	}
+	result, err = resolver.StrictNSQuery("www.unsigned.org.", dns.TypeA)
+	if err != nil || result.Status != Insecure || len(result.RRs) != 1 {
+		t.Error("should return insecure results: ", err)
+	}
+}
+
+func TestInsecureDelegationStrippedDS(t *testing.T) {
+	n := newSignedTestNet(t)
+	org := n.zones["org."]
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "example.org." && qtype == dns.TypeDS {
+			msg.Answer = nil
+			msg.Ns = org.denial(t, qname)
+		}
+	}
+	resolver := n.newResolver()
+	result, err := resolver.LookupIPv4("www.example.org.")
+	if !errors.Is(err, ErrDsNotAvailable) {
+		t.Error("should return ErrDsNotAvailable: ", err)
+	}
+	if len(result.IPs()) > 0 {
+		t.Error("lookup shouldn't return results")
+	}
+}
+
+func TestInsecureDelegationForgedDenial(t *testing.T) {
+	n := newSignedTestNet(t)
+	org := n.zones["org."]
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "example.org." && qtype == dns.TypeDS {
+			msg.Answer = nil
+			msg.Ns = org.denial(t, qname)
+			for _, rr := range msg.Ns {
+				if nsec, ok := rr.(*dns.NSEC); ok {
+					nsec.TypeBitMap = []uint16{dns.TypeNS, dns.TypeRRSIG, dns.TypeNSEC}
+				}
+			}
+		}
+	}
+	resolver := n.newResolver()
+	if _, err := resolver.LookupIPv4("www.example.org."); !errors.Is(err, ErrDsNotAvailable) {
+		t.Error("should return ErrDsNotAvailable: ", err)
+	}
+}
+
+func TestInsecureDelegationUnsignedAnswer(t *testing.T) {
+	n := newSignedTestNet(t)
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "www.example.org." && qtype == dns.TypeA {
+			msg.Answer = msg.Answer[:1]
+		}
+	}
+	resolver := n.newResolver()
+	if _, err := resolver.LookupIPv4("www.example.org."); !errors.Is(err, ErrResourceNotSigned) {
+		t.Error("should return ErrResourceNotSigned: ", err)
+	}
+	result, err := resolver.StrictNSQuery("www.example.org.", dns.TypeA)
+	if !errors.Is(err, ErrResourceNotSigned) || len(result.RRs) > 0 {
+		t.Error("should return ErrResourceNotSigned: ", err)
+	}
+	if _, err := resolver.LookupIP("www.example.org."); !errors.Is(err, ErrResourceNotSigned) {
+		t.Error("should return ErrResourceNotSigned: ", err)
+	}
+}
+
+func TestInsecureDelegationBadSignature(t *testing.T) {
+	n := newInsecureTestNet(t)
+	unsigned := n.zones["unsigned.org."]
+	key, signer := n.newKey("unsigned.org.", 257)
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "www.unsigned.org." && qtype == dns.TypeA {
+			msg.Answer = append(msg.Answer, unsigned.sign(t, msg.Answer, key, signer))
+		}
+	}
+	resolver := n.newResolver()
+	if result, err := resolver.LookupIPv4("www.unsigned.org."); err != nil || result.Status != Insecure {
+		t.Error("signatures in an insecure zone shouldn't matter: ", err)
+	}
+}
+
+func TestUnsignedDS(t *testing.T) {
+	n := newSignedTestNet(t)
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "example.org." && qtype == dns.TypeDS {
+			// Strip the RRSIG of the DS RRset.
+			msg.Answer = msg.Answer[:len(msg.Answer)-1]
+		}
+	}
+	resolver := n.newResolver()
+
+	_, err := resolver.LookupIPv4("www.example.org.")
+	if !errors.Is(err, ErrRrsigValidationError) || !errors.Is(err, ErrResourceNotSigned) {
+		t.Error("unsigned DS RRset shouldn't validate: ", err)
+	}
+}
+
+// signWithInsecureSigner replaces the signer name of the RRSIGs in the
+// answer for qname and qtype by the insecure delegation unsigned.org.
+func signWithInsecureSigner(n *testNet, qname string, qtype uint16) {
+	n.tamper = func(name string, rrType uint16, msg *dns.Msg) {
+		if name != qname || rrType != qtype {
+			return
+		}
+		for _, rr := range append(msg.Answer, msg.Ns...) {
+			if rrSig, ok := rr.(*dns.RRSIG); ok {
+				rrSig.SignerName = "unsigned.org."
+			}
+		}
+	}
+}
+
+func TestInsecureSignerName(t *testing.T) {
+	n := newInsecureTestNet(t)
+	signWithInsecureSigner(n, "www.example.org.", dns.TypeA)
+	resolver := n.newResolver()
+
+	result, err := resolver.StrictNSQuery("www.example.org.", dns.TypeA)
+	if !errors.Is(err, ErrInvalidSignerName) || result.Status != Bogus || len(result.RRs) > 0 {
+		t.Error("the signer name shouldn't make an answer insecure: ", err)
+	}
+	result, err = resolver.LookupIP("www.example.org.")
+	if !errors.Is(err, ErrInvalidSignerName) || result.Status != Bogus || len(result.RRs) > 0 {
+		t.Error("the signer name shouldn't make an answer insecure: ", err)
+	}
+}
+
+func TestInsecureSignerNameCNAME(t *testing.T) {
+	n := newInsecureTestNet(t)
+	example := n.zones["example.org."]
+	example.add(t, "alias.example.org. 300 IN CNAME www.example.org.")
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "alias.example.org." && qtype == dns.TypeA {
+			cname := example.lookup(t, qname, dns.TypeCNAME)
+			cname[1].(*dns.RRSIG).SignerName = "unsigned.org."
+			msg.Answer = append(cname, example.lookup(t, "www.example.org.", dns.TypeA)...)
+			msg.Ns = nil
+		}
+	}
+	resolver := n.newResolver()
+
+	result, err := resolver.LookupIPv4("alias.example.org.")
+	if !errors.Is(err, ErrInvalidSignerName) || result.Status != Bogus || len(result.RRs) > 0 {
+		t.Error("the signer name shouldn't make a CNAME insecure: ", err)
+	}
+}
+
+func TestInsecureSignerNameDenial(t *testing.T) {
+	n := newInsecureTestNet(t)
+	signWithInsecureSigner(n, "www.example.org.", dns.TypeTXT)
+	resolver := n.newResolver()
+
+	result, err := resolver.StrictNSQuery("www.example.org.", dns.TypeTXT)
+	if !errors.Is(err, ErrNoDenialProof) || result.Status != Bogus {
+		t.Error("the signer name shouldn't make a denial insecure: ", err)
+	}
+}
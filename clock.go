@@ -0,0 +1,50 @@
+package goresolver
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// SetClock sets the function returning the current time, which is used
+// to check the validity period of signatures and the expiration of
+// negative trust anchors.  A nil clock restores time.Now.  Signatures
+// in authentication chains are checked with the clock of the package
+// Resolver instance.
+func (resolver *Resolver) SetClock(clock func() time.Time) {
+	resolver.clock = clock
+}
+
+// SetSignatureTimeSkew sets how far the clock of the resolver may be
+// off: signatures are accepted up to skew before their inception and
+// after their expiration.  Negative values are treated as zero.  As
+// with SetClock, lookups use the skew of the package Resolver instance.
+func (resolver *Resolver) SetSignatureTimeSkew(skew time.Duration) {
+	if skew < 0 {
+		skew = 0
+	}
+	resolver.skew = skew
+}
+
+// now returns the current time of the resolver's clock.
+func (resolver *Resolver) now() time.Time {
+	if resolver.clock != nil {
+		return resolver.clock()
+	}
+	return time.Now()
+}
+
+// validityPeriodError checks the validity period of rrSig at now,
+// allowing for skew.  It returns ErrRrsigNotYetValid or ErrRrsigExpired
+// outside of the validity period.
+func validityPeriodError(rrSig *dns.RRSIG, now time.Time, skew time.Duration) error {
+	// Signature times use serial number arithmetic (RFC 4034
+	// section 3.1.5).
+	if int32(rrSig.Inception-uint32(now.Add(skew).Unix())) > 0 {
+		return ErrRrsigNotYetValid
+	}
+	if int32(uint32(now.Add(-skew).Unix())-rrSig.Expiration) > 0 {
+		return ErrRrsigExpired
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package goresolver
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSetClock(t *testing.T) {
+	resolver := newSignedTestNet(t).newResolver()
+
+	resolver.SetClock(func() time.Time { return time.Now().Add(48 * time.Hour) })
+	_, err := resolver.LookupIPv4("www.example.org.")
+	if !errors.Is(err, ErrRrsigExpired) {
+		t.Error("signatures should be checked at the time of the clock: ", err)
+	}
+
+	resolver.SetClock(nil)
+	if _, err := resolver.LookupIPv4("www.example.org."); err != nil {
+		t.Error("nil clock should use the current time: ", err)
+	}
+}
+
+func TestSignatureTimeSkew(t *testing.T) {
+	n := newSignedTestNet(t)
+	example := n.zones["example.org."]
+	example.inception = time.Now().Add(-time.Hour)
+	example.expiration = time.Now().Add(-time.Minute)
+	resolver := n.newResolver()
+
+	_, err := resolver.LookupIPv4("www.example.org.")
+	if !errors.Is(err, ErrRrsigExpired) {
+		t.Error("expired signature shouldn't validate without skew: ", err)
+	}
+
+	resolver.SetSignatureTimeSkew(5 * time.Minute)
+	if _, err := resolver.LookupIPv4("www.example.org."); err != nil {
+		t.Error("signature expired within the skew should validate: ", err)
+	}
+
+	example.inception = time.Now().Add(10 * time.Minute)
+	example.expiration = time.Now().Add(time.Hour)
+	_, err = resolver.LookupIPv4("www.example.org.")
+	if !errors.Is(err, ErrRrsigNotYetValid) {
+		t.Error("signature beyond the skew shouldn't validate: ", err)
+	}
+}
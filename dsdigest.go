@@ -0,0 +1,81 @@
+package goresolver
+
+import (
+	"log"
+
+	"github.com/miekg/dns"
+)
+
+// dsDigestTypes are the DS digest types the package can verify.
+var dsDigestTypes = []uint8{dns.SHA1, dns.SHA256, dns.SHA384}
+
+// DefaultDsDigestTypes returns the DS digest types a Resolver verifies by
+// default: SHA-1, SHA-256 and SHA-384.
+func DefaultDsDigestTypes() []uint8 {
+	return append([]uint8(nil), dsDigestTypes...)
+}
+
+// SetDsDigestTypes sets the DS digest types the resolver verifies.  DS
+// RRs with other digest types are ignored.  It returns
+// ErrUnknownDsDigestType if one of digestTypes is not implemented.
+// Like the algorithm policy, the digest types only take effect on the
+// package Resolver instance.
+func (resolver *Resolver) SetDsDigestTypes(digestTypes []uint8) error {
+	supported := make(map[uint8]bool, len(digestTypes))
+	for _, digestType := range digestTypes {
+		if !isKnownDsDigestType(digestType) {
+			return ErrUnknownDsDigestType
+		}
+		supported[digestType] = true
+	}
+	resolver.dsDigestTypes = supported
+	return nil
+}
+
+// isKnownDsDigestType returns true if the package implements digestType.
+func isKnownDsDigestType(digestType uint8) bool {
+	for _, t := range dsDigestTypes {
+		if t == digestType {
+			return true
+		}
+	}
+	return false
+}
+
+// supportedDS returns the DS RRs of dsRrset whose digest type and
+// algorithm the resolver verifies.  SHA-1 DS RRs are ignored if a SHA-256 or SHA-384
+// DS RR is present for the same key (RFC 4509 section 3).
+func supportedDS(dsRrset []dns.RR) []*dns.DS {
+	type dsKey struct {
+		keyTag    uint16
+		algorithm uint8
+	}
+	stronger := make(map[dsKey]bool)
+	dsSet := make([]*dns.DS, 0, len(dsRrset))
+	for _, rr := range dsRrset {
+		ds, ok := rr.(*dns.DS)
+		if !ok {
+			continue
+		}
+		if !resolver.dsDigestTypes[ds.DigestType] {
+			log.Printf("Unsupported digest type (%d) on DS RR", ds.DigestType)
+			continue
+		}
+		if resolver.algorithmSupport(ds.Algorithm) != AlgorithmSupported {
+			continue
+		}
+		if ds.DigestType == dns.SHA256 || ds.DigestType == dns.SHA384 {
+			stronger[dsKey{ds.KeyTag, ds.Algorithm}] = true
+		}
+		dsSet = append(dsSet, ds)
+	}
+
+	preferred := dsSet[:0]
+	for _, ds := range dsSet {
+		if ds.DigestType == dns.SHA1 && stronger[dsKey{ds.KeyTag, ds.Algorithm}] {
+			continue
+		}
+		preferred = append(preferred, ds)
+	}
+	return preferred
+}
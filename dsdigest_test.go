@@ -0,0 +1,67 @@
+package goresolver
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestDsDigestTypes(t *testing.T) {
+	for _, digestType := range DefaultDsDigestTypes() {
+		n := newSignedTestNet(t)
+		n.setDS("example.org.", digestType)
+		resolver := n.newResolver()
+		if _, err := resolver.LookupIPv4("www.example.org."); err != nil {
+			t.Errorf("%s DS should validate: %s", dns.HashToString[digestType], err)
+		}
+	}
+}
+
+func TestDsDigestTypesConfigured(t *testing.T) {
+	n := newSignedTestNet(t)
+	n.setDS("example.org.", dns.SHA1)
+	resolver := n.newResolver()
+	if err := resolver.SetDsDigestTypes([]uint8{dns.SHA256, dns.SHA384}); err != nil {
+		t.Fatal("shouldn't return err: ", err)
+	}
+	result, err := resolver.LookupIPv4("www.example.org.")
+	if err != nil || result.Status != Insecure {
+		t.Error("zones with only disabled digest types should be insecure: ", err)
+	}
+	if len(result.IPs()) != 1 {
+		t.Error("lookup should return results")
+	}
+
+	n.setDS("example.org.", dns.SHA1, dns.SHA256)
+	resolver = n.newResolver()
+	if err := resolver.SetDsDigestTypes([]uint8{dns.SHA256}); err != nil {
+		t.Fatal("shouldn't return err: ", err)
+	}
+	result, err = resolver.LookupIPv4("www.example.org.")
+	if err != nil || result.Status != Secure {
+		t.Error("enabled digest types should validate: ", err)
+	}
+	if resolver.SetDsDigestTypes([]uint8{dns.GOST94}) != ErrUnknownDsDigestType {
+		t.Error("should reject unimplemented digest types")
+	}
+}
+
+func TestSupportedDSPreferSHA256(t *testing.T) {
+	n := newSignedTestNet(t)
+	n.newResolver()
+	example := n.zones["example.org."]
+	other, _ := n.newKey("example.org.", 257)
+
+	dsRrset := []dns.RR{
+		example.ksk.ToDS(dns.SHA1),
+		example.ksk.ToDS(dns.SHA256),
+		other.ToDS(dns.SHA1),
+	}
+	dsSet := supportedDS(dsRrset)
+	if len(dsSet) != 2 {
+		t.Fatal("should ignore the SHA-1 DS of the key with a SHA-256 DS: ", dsSet)
+	}
+	if dsSet[0].DigestType != dns.SHA256 || dsSet[1].KeyTag != other.KeyTag() {
+		t.Error("should keep the SHA-256 DS and the SHA-1 DS of the other key: ", dsSet)
+	}
+}
@@ -0,0 +1,99 @@
+package goresolver
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// ExtendedErrorCode is an Extended DNS Error info code (RFC 8914).
+type ExtendedErrorCode uint16
+
+// Extended DNS Error info codes describing validation failures.
+const (
+	EDEOther                      ExtendedErrorCode = 0
+	EDEUnsupportedDnskeyAlgorithm ExtendedErrorCode = 1
+	EDEUnsupportedDsDigestType    ExtendedErrorCode = 2
+	EDEDnssecIndeterminate        ExtendedErrorCode = 5
+	EDEDnssecBogus                ExtendedErrorCode = 6
+	EDESignatureExpired           ExtendedErrorCode = 7
+	EDESignatureNotYetValid       ExtendedErrorCode = 8
+	EDEDnskeyMissing              ExtendedErrorCode = 9
+	EDERrsigsMissing              ExtendedErrorCode = 10
+	EDENoZoneKeyBitSet            ExtendedErrorCode = 11
+	EDENsecMissing                ExtendedErrorCode = 12
+	EDENoReachableAuthority       ExtendedErrorCode = 22
+)
+
+var extendedErrorCodeToString = map[ExtendedErrorCode]string{
+	EDEOther:                      "Other",
+	EDEUnsupportedDnskeyAlgorithm: "Unsupported DNSKEY Algorithm",
+	EDEUnsupportedDsDigestType:    "Unsupported DS Digest Type",
+	EDEDnssecIndeterminate:        "DNSSEC Indeterminate",
+	EDEDnssecBogus:                "DNSSEC Bogus",
+	EDESignatureExpired:           "Signature Expired",
+	EDESignatureNotYetValid:       "Signature Not Yet Valid",
+	EDEDnskeyMissing:              "DNSKEY Missing",
+	EDERrsigsMissing:              "RRSIGs Missing",
+	EDENoZoneKeyBitSet:            "No Zone Key Bit Set",
+	EDENsecMissing:                "NSEC Missing",
+	EDENoReachableAuthority:       "No Reachable Authority",
+}
+
+func (c ExtendedErrorCode) String() string {
+	if s, ok := extendedErrorCodeToString[c]; ok {
+		return s
+	}
+	return fmt.Sprintf("EDE%d", uint16(c))
+}
+
+// ExtendedError is an Extended DNS Error, which can be passed on to DNS
+// clients in an EDNS0 option (RFC 8914).
+type ExtendedError struct {
+	InfoCode  ExtendedErrorCode
+	ExtraText string
+}
+
+func (e *ExtendedError) String() string {
+	return fmt.Sprintf("%d (%s): %s", e.InfoCode, e.InfoCode, e.ExtraText)
+}
+
+// extendedErrorCode returns the Extended DNS Error info code for a
+// validation error.
+func extendedErrorCode(err error) ExtendedErrorCode {
+	switch {
+	case errors.Is(err, ErrRrsigExpired):
+		return EDESignatureExpired
+	case errors.Is(err, ErrRrsigNotYetValid):
+		return EDESignatureNotYetValid
+	case errors.Is(err, dns.ErrAlg), errors.Is(err, ErrUnsupportedAlgorithm),
+		errors.Is(err, ErrDisallowedAlgorithm):
+		return EDEUnsupportedDnskeyAlgorithm
+	case errors.Is(err, ErrUnknownDsDigestType):
+		return EDEUnsupportedDsDigestType
+	case errors.Is(err, ErrDnskeyNotAvailable):
+		return EDEDnskeyMissing
+	case errors.Is(err, ErrNoZoneKey):
+		return EDENoZoneKeyBitSet
+	case errors.Is(err, ErrResourceNotSigned):
+		return EDERrsigsMissing
+	case errors.Is(err, ErrNoDenialProof):
+		return EDENsecMissing
+	case errors.Is(err, ErrNsNotAvailable):
+		return EDENoReachableAuthority
+	case validationStatus(err) == Indeterminate:
+		return EDEDnssecIndeterminate
+	}
+	return EDEDnssecBogus
+}
+
+// extendedError returns the Extended DNS Error for an answer with the
+// given validation status and error, or nil if the answer is secure or
+// insecure.
+func extendedError(status ValidationStatus, err error) *ExtendedError {
+	if status == Secure || status == Insecure || err == nil {
+		return nil
+	}
+	return &ExtendedError{InfoCode: extendedErrorCode(err), ExtraText: err.Error()}
+}
@@ -0,0 +1,95 @@
+package goresolver
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestExtendedErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code ExtendedErrorCode
+	}{
+		{newValidationError(ErrInvalidRRsig, "example.org.", 0, nil, ErrRrsigExpired), EDESignatureExpired},
+		{newValidationError(ErrInvalidRRsig, "example.org.", 0, nil, ErrRrsigNotYetValid), EDESignatureNotYetValid},
+		{newValidationError(ErrInvalidRRsig, "example.org.", 0, nil, dns.ErrAlg), EDEUnsupportedDnskeyAlgorithm},
+		{newValidationError(ErrDsInvalid, "example.org.", 0, nil, ErrUnknownDsDigestType), EDEUnsupportedDsDigestType},
+		{newValidationError(ErrDsInvalid, "example.org.", 0, nil, errors.New("mismatch")), EDEDnssecBogus},
+		{newValidationError(ErrDnskeyNotAvailable, "example.org.", 0, nil, nil), EDEDnskeyMissing},
+		{newValidationError(ErrNoTrustAnchor, ".", 0, nil, nil), EDEDnssecIndeterminate},
+		{ErrResourceNotSigned, EDERrsigsMissing},
+		{ErrNoDenialProof, EDENsecMissing},
+	}
+	for _, test := range tests {
+		if code := extendedErrorCode(test.err); code != test.code {
+			t.Errorf("%v: got %s, want %s", test.err, code, test.code)
+		}
+	}
+}
+
+func TestExtendedErrorSignatureExpired(t *testing.T) {
+	resolver := newBrokenTestNet(t).newResolver()
+
+	result, err := resolver.LookupIPv4("www.example.org.")
+	if result.ExtendedError == nil || result.ExtendedError.InfoCode != EDESignatureExpired {
+		t.Error("should return Signature Expired: ", result.ExtendedError)
+	}
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || validationErr.ExtendedError().InfoCode != EDESignatureExpired {
+		t.Error("error should map to Signature Expired: ", err)
+	}
+}
+
+func TestExtendedErrorSignatureNotYetValid(t *testing.T) {
+	n := newSignedTestNet(t)
+	example := n.zones["example.org."]
+	example.inception = time.Now().Add(24 * time.Hour)
+	example.expiration = time.Now().Add(48 * time.Hour)
+	resolver := n.newResolver()
+
+	result, _ := resolver.StrictNSQuery("www.example.org.", dns.TypeA)
+	if result.ExtendedError == nil || result.ExtendedError.InfoCode != EDESignatureNotYetValid {
+		t.Error("should return Signature Not Yet Valid: ", result.ExtendedError)
+	}
+}
+
+func TestExtendedErrorDsWithoutDnskey(t *testing.T) {
+	resolver := newBrokenTestNet(t).newResolver()
+
+	// The DS of other.org. references a key the zone doesn't publish.
+	result, _ := resolver.LookupIP("www.other.org.")
+	if result.ExtendedError == nil || result.ExtendedError.InfoCode != EDEDnskeyMissing {
+		t.Error("should return DNSKEY Missing: ", result.ExtendedError)
+	}
+}
+
+func TestExtendedErrorDnskeyMissing(t *testing.T) {
+	n := newSignedTestNet(t)
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "example.org." && qtype == dns.TypeDNSKEY {
+			msg.Answer = nil
+		}
+	}
+	resolver := n.newResolver()
+
+	result, _ := resolver.LookupIPv4("www.example.org.")
+	if result.ExtendedError == nil || result.ExtendedError.InfoCode != EDEDnskeyMissing {
+		t.Error("should return DNSKEY Missing: ", result.ExtendedError)
+	}
+}
+
+func TestExtendedErrorNone(t *testing.T) {
+	resolver := newSignedTestNet(t).newResolver()
+
+	result, _ := resolver.LookupIPv4("www.example.org.")
+	if result.ExtendedError != nil {
+		t.Error("secure answers shouldn't return an extended error: ", result.ExtendedError)
+	}
+	result, _ = resolver.StrictNSQuery("nonexistent.example.org.", dns.TypeA)
+	if result.ExtendedError != nil {
+		t.Error("proven NXDOMAIN shouldn't return an extended error: ", result.ExtendedError)
+	}
+}
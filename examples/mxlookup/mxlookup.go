@@ -25,9 +25,9 @@ func main() {
 	result, err := resolver.StrictNSQuery(dns.Fqdn(hostname), dns.TypeMX)
 
 	if err != nil {
-		fmt.Printf("Validation failed: %s\n", err)
+		fmt.Printf("Validation failed (%s): %s\n", result.Status, err)
 		os.Exit(1)
 	}
 
-	fmt.Println("DNSSEC validation successful\n", result)
+	fmt.Println("DNSSEC validation successful\n", result.RRs)
 }
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/peterzen/goresolver"
+)
+
+func main() {
+
+	if len(os.Args) < 2 {
+		fmt.Printf("Usage: rootanchors <root-anchors.xml>\n")
+		os.Exit(0)
+	}
+	fileName := os.Args[1]
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		fmt.Printf("Cannot open %s: %s\n", fileName, err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	keyDigests, err := goresolver.ParseTrustAnchorXML(f)
+	if err != nil {
+		fmt.Printf("Cannot parse %s: %s\n", fileName, err)
+		os.Exit(1)
+	}
+
+	now := time.Now()
+	for _, kd := range keyDigests {
+		if !kd.IsValid(now) {
+			continue
+		}
+		fmt.Println(kd.DS)
+	}
+}
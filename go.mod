@@ -1,5 +1,7 @@
 module github.com/peterzen/goresolver
 
+go 1.16
+
 require (
 	github.com/miekg/dns v1.1.4
 	golang.org/x/crypto v0.0.0-20190222235706-ffb98f73852f // indirect
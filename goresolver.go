@@ -2,6 +2,7 @@ package goresolver
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/miekg/dns"
@@ -14,10 +15,25 @@ const (
 // Resolver contains the client configuration for github.com/miekg/dns,
 // the instantiated client and the func that performs the actual queries.
 // queryFn can be used for mocking the actual DNS lookups in the test suite.
+//
+// The package keeps a single Resolver instance, the one most recently
+// returned by NewResolver.  Authentication chains are populated and
+// verified with its queries and settings (trust anchors, algorithm
+// policy, DS digest types, clock and signature time skew), whichever
+// Resolver the lookup is called on, so only one Resolver should be
+// used at a time.
 type Resolver struct {
 	queryFn         func(string, uint16) (*dns.Msg, error)
 	dnsClient       *dns.Client
 	dnsClientConfig *dns.ClientConfig
+	trustAnchors    trustAnchors
+
+	managedTrustAnchors *ManagedTrustAnchors
+	ntas                negativeTrustAnchors
+	dsDigestTypes       map[uint8]bool
+	algorithms          map[uint8]AlgorithmSupport
+	clock               func() time.Time
+	skew                time.Duration
 }
 
 // Errors returned by the verification/validation methods at all levels.
@@ -31,9 +47,24 @@ var (
 	ErrForgedRRsig          = errors.New("forged RRSIG header")
 	ErrRrsigValidationError = errors.New("RR doesn't validate against RRSIG")
 	ErrRrsigValidityPeriod  = errors.New("invalid RRSIG validity period")
+	ErrRrsigExpired         = fmt.Errorf("%w: signature expired", ErrRrsigValidityPeriod)
+	ErrRrsigNotYetValid     = fmt.Errorf("%w: signature not yet valid", ErrRrsigValidityPeriod)
 	ErrUnknownDsDigestType  = errors.New("unknown DS digest type")
 	ErrDsInvalid            = errors.New("DS RR does not match DNSKEY")
 	ErrInvalidQuery         = errors.New("invalid query input")
+	ErrInvalidTrustAnchor   = errors.New("invalid trust anchor")
+	ErrTrustAnchorMismatch  = errors.New("DNSKEY RR does not match trust anchor")
+	ErrNoTrustAnchor        = errors.New("no trust anchor for zone")
+	ErrNxDomain             = errors.New("domain name does not exist")
+	ErrNoData               = errors.New("requested RR type does not exist")
+	ErrNoDenialProof        = errors.New("denial of existence not proven")
+	ErrInsecureDelegation   = errors.New("zone is provably not signed")
+	ErrUnsupportedAlgorithm = errors.New("DNSSEC algorithm is not supported")
+	ErrDisallowedAlgorithm  = errors.New("DNSSEC algorithm is not allowed")
+	ErrNoZoneKey            = errors.New("DNSKEY is not a zone key")
+	ErrRevokedKey           = errors.New("DNSKEY is revoked")
+	ErrInvalidRrsigLabels   = errors.New("RRSIG labels exceed the owner name")
+	ErrInvalidSignerName    = errors.New("RRSIG signer is not a zone of the owner name")
 )
 
 var resolver *Resolver
@@ -80,23 +111,36 @@ func localQuery(qname string, qtype uint16) (*dns.Msg, error) {
 func queryDelegation(domainName string) (signedZone *SignedZone, err error) {
 
 	signedZone = NewSignedZone(domainName)
+	signedZone.now = resolver.now
+	signedZone.skew = resolver.skew
 
 	signedZone.dnskey, err = resolver.queryRRset(domainName, dns.TypeDNSKEY)
+	// A name that doesn't exist has no DNSKEY RRs, the denial in the DS
+	// answer has to prove it is not a zone cut.
+	if err == ErrNoResult && signedZone.dnskey != nil {
+		err = nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	signedZone.pubKeyLookup = make(map[uint16]*dns.DNSKEY)
+	signedZone.pubKeyLookup = make(map[uint16][]*dns.DNSKEY)
 	for _, rr := range signedZone.dnskey.rrSet {
 		signedZone.addPubKey(rr.(*dns.DNSKEY))
 	}
 
+	// An empty DS answer keeps the NSEC or NSEC3 records, which have to
+	// prove that the zone is not signed.
 	signedZone.ds, _ = resolver.queryRRset(domainName, dns.TypeDS)
+	if signedZone.ds == nil {
+		signedZone.ds = NewSignedRRSet()
+	}
 
 	return signedZone, nil
 }
 
 // NewResolver initializes the package Resolver instance using the default
-// dnsClientConfig.
+// dnsClientConfig.  It replaces the Resolver returned by previous calls,
+// whose settings no longer apply.
 func NewResolver(resolvConf string) (res *Resolver, err error) {
 	resolver = &Resolver{}
 	resolver.dnsClient = &dns.Client{
@@ -107,5 +151,10 @@ func NewResolver(resolvConf string) (res *Resolver, err error) {
 		return nil, err
 	}
 	resolver.queryFn = localQuery
+	resolver.trustAnchors.anchors = map[string][]*dns.DS{
+		".": DefaultRootTrustAnchors(),
+	}
+	_ = resolver.SetDsDigestTypes(DefaultDsDigestTypes())
+	_ = resolver.SetAlgorithmPolicy(DefaultAlgorithmPolicy())
 	return resolver, nil
 }
@@ -2,37 +2,88 @@ package goresolver
 
 import (
 	"log"
-	"net"
+	"time"
 
 	"github.com/miekg/dns"
 )
 
-const MaxReturnedIPAddressesCount = 64
-
-func (resolver *Resolver) LookupIP(qname string) (ips []net.IP, err error) {
+// LookupIP queries the A and AAAA RRs of qname.  The result holds the
+// RRs that validated, along with their validation status.
+func (resolver *Resolver) LookupIP(qname string) (result *Result, err error) {
 
+	result = &Result{}
+	defer func() {
+		err = lookupError(result.Status, err)
+		result.ExtendedError = extendedError(result.Status, err)
+	}()
 	if len(qname) < 1 {
-		return nil, nil
+		return result, nil
 	}
 
 	qtypes := []uint16{dns.TypeA, dns.TypeAAAA}
 
 	answers := make([]*RRSet, 0, len(qtypes))
 
+	insecure := resolver.isNegativeTrustAnchor(qname)
+
+	// resultErr is returned if there is no answer to validate.  It is
+	// ErrNoData only if every answer is a proven NODATA.
+	var resultErr, insecureErr error
+
+	// The CNAME RRsets leading to the answers.
+	cnameStatus := Secure
+	var cnameValidity time.Duration
+	var cnameAnswer *RRSet
+	defer func() {
+		if cnameAnswer != nil {
+			err = result.addCNAMEs(cnameAnswer, cnameStatus, cnameValidity, err)
+		}
+	}()
+
 	for _, qtype := range qtypes {
 
 		answer, err := resolver.queryRRset(qname, qtype)
 		if answer == nil {
 			continue
 		}
+		if len(answer.cnames) > 0 {
+			status, validity, err := resolver.verifyCNAMEs(answer)
+			if status != Secure && status != Insecure {
+				result.Status = status
+				return result, err
+			}
+			if cnameAnswer == nil || validity < cnameValidity {
+				cnameValidity = validity
+			}
+			if status == Insecure {
+				cnameStatus = status
+			}
+			cnameAnswer = answer
+		}
+		if answer.nameError {
+			result.Status, err = resolver.verifyDenial(qname, qtype, answer)
+			return result, err
+		}
 		if err != nil {
 			continue
 		}
 		if answer.IsEmpty() {
+			status, err := resolver.verifyDenial(qname, qtype, answer)
+			if resultErr == nil || resultErr == ErrNoData {
+				result.Status, resultErr = status, err
+			}
 			continue
 		}
-		if !answer.IsSigned() {
-			continue
+		if resolver.isNegativeTrustAnchor(answer.owner(qname)) {
+			insecure = true
+		}
+		if !answer.IsSigned() && !insecure {
+			err = resolver.verifyUnsigned(answer.owner(qname))
+			if err != ErrInsecureDelegation {
+				result.Status, resultErr = Bogus, err
+				continue
+			}
+			insecure, insecureErr = true, err
 		}
 
 		answers = append(answers, answer)
@@ -40,7 +91,18 @@ func (resolver *Resolver) LookupIP(qname string) (ips []net.IP, err error) {
 
 	if len(answers) < 1 {
 		log.Printf("no results")
-		return nil, ErrNoResult
+		if resultErr != nil {
+			return result, resultErr
+		}
+		return result, ErrNoResult
+	}
+
+	if insecure {
+		for _, answer := range answers {
+			result.RRs = append(result.RRs, answer.rrSet...)
+		}
+		result.Status = Insecure
+		return result, insecureErr
 	}
 
 	signerName := answers[0].SignerName()
@@ -48,48 +110,92 @@ func (resolver *Resolver) LookupIP(qname string) (ips []net.IP, err error) {
 	err = authChain.Populate(signerName)
 	if err != nil {
 		log.Printf("Cannot populate authentication chain: %s\n", err)
-		return nil, err
+		result.Status = validationStatus(err)
+		return result, err
 	}
-	resultIPs := make([]net.IP, MaxReturnedIPAddressesCount)
+
+	// Return the answers that validate, or the first error if none does.
+	var verifyErr error
 	for _, answer := range answers {
-		err = authChain.Verify(answer)
-		if err != nil {
+		status, err := resolver.verifySigned(answer.owner(qname), authChain, answer)
+		if status != Secure && status != Insecure {
 			log.Printf("DNSSEC validation failed: %s\n", err)
+			if verifyErr == nil {
+				result.Status, verifyErr = status, err
+			}
 			continue
 		}
-		ips := formatResultRRs(answer)
-		resultIPs = append(resultIPs, ips...)
+		result.Status, insecureErr = status, err
+		result.addVerifiedAnswer(authChain, answer)
+	}
+	if len(result.RRs) < 1 {
+		return result, verifyErr
 	}
 
-	return resultIPs, nil
+	return result, insecureErr
 }
 
-func (resolver *Resolver) LookupIPv4(qname string) (ips []net.IP, err error) {
+// LookupIPv4 queries the A RRs of qname.
+func (resolver *Resolver) LookupIPv4(qname string) (*Result, error) {
 	return resolver.LookupIPType(qname, dns.TypeA)
 }
 
-func (resolver *Resolver) LookupIPv6(qname string) (ips []net.IP, err error) {
+// LookupIPv6 queries the AAAA RRs of qname.
+func (resolver *Resolver) LookupIPv6(qname string) (*Result, error) {
 	return resolver.LookupIPType(qname, dns.TypeAAAA)
 }
 
 // Queries an A or AAAA RR
-func (resolver *Resolver) LookupIPType(qname string, qtype uint16) (ips []net.IP, err error) {
-
+// Unsigned answers that are not proven insecure are returned with a
+// Bogus status and ErrResourceNotSigned.
+func (resolver *Resolver) LookupIPType(qname string, qtype uint16) (result *Result, err error) {
+
+	result = &Result{}
+	defer func() {
+		err = lookupError(result.Status, err)
+		result.ExtendedError = extendedError(result.Status, err)
+	}()
 	if len(qname) < 1 {
-		return nil, nil
+		return result, nil
 	}
 
 	answer, err := resolver.queryRRset(qname, qtype)
 	if answer == nil {
-		return nil, ErrNoResult
+		return result, ErrNoResult
+	}
+
+	cnameStatus, cnameValidity, cnameErr := resolver.verifyCNAMEs(answer)
+	if cnameStatus != Secure && cnameStatus != Insecure {
+		result.Status = cnameStatus
+		return result, cnameErr
+	}
+	defer func() {
+		err = result.addCNAMEs(answer, cnameStatus, cnameValidity, err)
+	}()
+
+	if answer.nameError {
+		result.Status, err = resolver.verifyDenial(qname, qtype, answer)
+		return result, err
 	}
 
 	if err != nil {
-		return nil, err
+		return result, err
+	}
+
+	if answer.IsEmpty() {
+		result.Status, err = resolver.verifyDenial(qname, qtype, answer)
+		return result, err
+	}
+
+	if resolver.isNegativeTrustAnchor(answer.owner(qname)) {
+		result.RRs, result.Status = answer.rrSet, Insecure
+		return result, nil
 	}
 
 	if !answer.IsSigned() {
-		return formatResultRRs(answer), ErrResourceNotSigned
+		err = resolver.verifyUnsigned(answer.owner(qname))
+		result.RRs, result.Status = answer.rrSet, validationStatus(err)
+		return result, err
 	}
 
 	signerName := answer.SignerName()
@@ -97,69 +203,169 @@ func (resolver *Resolver) LookupIPType(qname string, qtype uint16) (ips []net.IP
 	err = authChain.Populate(signerName)
 	if err != nil {
 		log.Printf("Cannot populate authentication chain: %s\n", err)
-		return nil, err
+		result.Status = validationStatus(err)
+		return result, err
 	}
 
-	err = authChain.Verify(answer)
-	if err != nil {
+	result.Status, err = resolver.verifySigned(answer.owner(qname), authChain, answer)
+	if result.Status != Secure && result.Status != Insecure {
 		log.Printf("DNSSEC validation failed: %s\n", err)
-		return nil, err
+		return result, err
 	}
 
-	return formatResultRRs(answer), nil
+	result.addVerifiedAnswer(authChain, answer)
+	return result, err
 }
 
-func (resolver *Resolver) StrictNSQuery(qname string, qtype uint16) (rrSet []dns.RR, err error) {
+// StrictNSQuery queries the qtype RRs of qname.  The result holds the
+// RRs if they validate, along with their validation status.
+func (resolver *Resolver) StrictNSQuery(qname string, qtype uint16) (result *Result, err error) {
 
+	result = &Result{}
+	defer func() {
+		err = lookupError(result.Status, err)
+		result.ExtendedError = extendedError(result.Status, err)
+	}()
 	if len(qname) < 1 {
-		return nil, ErrInvalidQuery
+		return result, ErrInvalidQuery
 	}
 
 	answer, err := resolver.queryRRset(qname, qtype)
+	if answer == nil {
+		return result, err
+	}
+
+	cnameStatus, cnameValidity, cnameErr := resolver.verifyCNAMEs(answer)
+	if cnameStatus != Secure && cnameStatus != Insecure {
+		result.Status = cnameStatus
+		return result, cnameErr
+	}
+	defer func() {
+		err = result.addCNAMEs(answer, cnameStatus, cnameValidity, err)
+	}()
+
+	if answer.nameError {
+		result.Status, err = resolver.verifyDenial(qname, qtype, answer)
+		return result, err
+	}
 	if err != nil {
-		return nil, err
+		return result, err
 	}
 
 	if answer.IsEmpty() {
-		return nil, ErrNoResult
+		result.Status, err = resolver.verifyDenial(qname, qtype, answer)
+		return result, err
+	}
+
+	if resolver.isNegativeTrustAnchor(answer.owner(qname)) {
+		result.RRs, result.Status = answer.rrSet, Insecure
+		return result, nil
 	}
 
 	if !answer.IsSigned() {
-		return nil, ErrResourceNotSigned
+		err = resolver.verifyUnsigned(answer.owner(qname))
+		result.Status = validationStatus(err)
+		if err == ErrInsecureDelegation {
+			result.RRs = answer.rrSet
+		}
+		return result, err
 	}
 
-	err = answer.CheckHeaderIntegrity(qname)
+	err = answer.CheckHeaderIntegrity(answer.owner(qname))
 	if err != nil {
-		return nil, err
+		result.Status = Bogus
+		return result, err
 	}
 
 	signerName := answer.SignerName()
 
 	authChain := NewAuthenticationChain()
 	err = authChain.Populate(signerName)
+	if err != nil {
+		log.Printf("Cannot populate authentication chain: %s\n", err)
+		result.Status = validationStatus(err)
+		return result, err
+	}
 
-	if err == ErrNoResult {
-		return nil, err
+	result.Status, err = resolver.verifySigned(answer.owner(qname), authChain, answer)
+	if result.Status != Secure && result.Status != Insecure {
+		log.Printf("DNSSEC validation failed: %s\n", err)
+		return result, err
 	}
 
-	err = authChain.Verify(answer)
+	result.addVerifiedAnswer(authChain, answer)
+	return result, err
+}
+
+// verifyUnsigned checks whether unsigned answers for qname are
+// legitimate.  It returns ErrInsecureDelegation if qname is provably in
+// an insecure zone, and ErrResourceNotSigned otherwise.
+func (resolver *Resolver) verifyUnsigned(qname string) error {
+	authChain := NewAuthenticationChain()
+	err := authChain.Populate(qname)
 	if err != nil {
-		log.Printf("DNSSEC validation failed: %s\n", err)
-		return nil, err
+		log.Printf("Cannot populate authentication chain: %s\n", err)
+		return ErrResourceNotSigned
+	}
+	_, err = authChain.VerifyInsecure()
+	if err != ErrInsecureDelegation {
+		log.Printf("unsigned answer for %s: %s\n", qname, err)
+		return ErrResourceNotSigned
 	}
+	return err
+}
 
-	return answer.rrSet, nil
+// verifySigned validates a signed answer for owner with authChain, the
+// chain of trust of its signer.  The signer name is chosen by whoever
+// signed the answer, so an Insecure status is only accepted if the chain
+// of trust of owner proves it as well; the answer is bogus otherwise.
+func (resolver *Resolver) verifySigned(owner string, authChain *AuthenticationChain, answer *RRSet) (ValidationStatus, error) {
+	status, err := authChain.Verify(answer)
+	if status == Insecure && resolver.verifyUnsigned(owner) != ErrInsecureDelegation {
+		log.Printf("%s is not in an insecure zone\n", owner)
+		return Bogus, newValidationError(ErrInvalidRRsig, answer.SignerName(), 0, answer, ErrInvalidSignerName)
+	}
+	return status, err
 }
 
-func formatResultRRs(signedRrset *RRSet) []net.IP {
-	ips := make([]net.IP, 0, len(signedRrset.rrSet))
-	for _, rr := range signedRrset.rrSet {
-		switch t := rr.(type) {
-		case *dns.A:
-			ips = append(ips, t.A)
-		case *dns.AAAA:
-			ips = append(ips, t.AAAA)
+// verifyCNAMEs validates the CNAME RRsets leading to answer, each with
+// the chain of trust of its signer.  It returns their validation status,
+// Secure if there are none, the remaining validity of the CNAME RRsets,
+// and the validation error if one of them fails.
+func (resolver *Resolver) verifyCNAMEs(answer *RRSet) (status ValidationStatus, validity time.Duration, err error) {
+	status = Secure
+	for i, cname := range answer.cnames {
+		owner := cname.rrSet[0].Header().Name
+		var cnameStatus ValidationStatus
+		var cnameErr error
+		switch {
+		case resolver.isNegativeTrustAnchor(owner):
+			cnameStatus = Insecure
+		case !cname.IsSigned():
+			cnameErr = resolver.verifyUnsigned(owner)
+			cnameStatus = validationStatus(cnameErr)
+		default:
+			authChain := NewAuthenticationChain()
+			cnameErr = authChain.Populate(cname.SignerName())
+			if cnameErr != nil {
+				cnameStatus = validationStatus(cnameErr)
+				break
+			}
+			cnameStatus, cnameErr = resolver.verifySigned(owner, authChain, cname)
+			if cnameStatus == Secure {
+				_, cnameValidity := authChain.clampTTLs(cname)
+				if i == 0 || cnameValidity < validity {
+					validity = cnameValidity
+				}
+			}
+		}
+		if cnameStatus != Secure && cnameStatus != Insecure {
+			log.Printf("CNAME %s failed validation: %s\n", owner, cnameErr)
+			return cnameStatus, 0, cnameErr
+		}
+		if cnameStatus == Insecure {
+			status = Insecure
 		}
 	}
-	return ips
+	return status, validity, nil
 }
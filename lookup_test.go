@@ -1,11 +1,13 @@
 package goresolver
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/miekg/dns"
 )
@@ -13,6 +15,10 @@ import (
 var isMockQuery = true
 var isMockUpdate = false
 
+// fixtureTime is a time at which the signatures of the fixtures under
+// testdata/, recorded in March 2019, are valid.
+var fixtureTime = time.Date(2019, 3, 7, 0, 0, 0, 0, time.UTC)
+
 func getMockFile(testName string, qname string, qtype uint16) (fileName string, baseDir string) {
 	baseDir = path.Join("./testdata", testName)
 	fileName = path.Join(baseDir, fmt.Sprintf("%d_%stxt", qtype, qname))
@@ -45,6 +51,9 @@ func mockQueryUpdate(t *testing.T, qname string, qtype uint16) (*dns.Msg, error)
 
 func newResolver(t *testing.T) (res *Resolver) {
 	resolver, _ := NewResolver("./testdata/resolv.conf")
+	if isMockQuery && !isMockUpdate {
+		resolver.SetClock(func() time.Time { return fixtureTime })
+	}
 	resolver.queryFn = func(qname string, qtype uint16) (*dns.Msg, error) {
 		msg := &dns.Msg{}
 		if isMockQuery == false {
@@ -100,213 +109,235 @@ func TestInitialize(t *testing.T) {
 //	resolver, _ := NewResolver("./testdata/resolv.conf")
 //	testName = t.Name()
 //	//resolver.queryFn = mockQuery
-//	ips, err := resolver.LookupIP("sigfail.verteiltesysteme.net.")
+//	result, err := resolver.LookupIP("sigfail.verteiltesysteme.net.")
 //	if err == nil {
 //		t.Errorf("dnssec validation failed: %v", err)
 //	}
-//	if len(ips) > 0 {
+//	if len(result.IPs()) > 0 {
 //		t.Error("lookup should return no results")
 //	}
 //}
 
 func TestLookupMissingResource(t *testing.T) {
 	resolver := newResolver(t)
-	ips, err := resolver.LookupIP("invalid.stakey.org.")
-	if err != ErrNoResult {
-		t.Errorf("should return ErrNoResult")
+	result, err := resolver.LookupIP("invalid.stakey.org.")
+	// The recorded answers from the signed zone have no NSEC records.
+	if !errors.Is(err, ErrNoDenialProof) {
+		t.Errorf("should return ErrNoDenialProof")
 	}
-	if len(ips) > 0 {
+	if len(result.IPs()) > 0 {
 		t.Error("lookup should return no results")
 	}
 }
 
 func TestLookupValid1(t *testing.T) {
 	resolver := newResolver(t)
-	ips, err := resolver.LookupIP("stakey.org.")
+	result, err := resolver.LookupIP("stakey.org.")
 	if err != nil {
 		t.Error("shouldn't return err: ", err)
 	}
-	if len(ips) < 1 {
+	if len(result.IPs()) < 1 {
 		t.Error("lookup should return results")
 	}
 }
 
 func TestLookupValid2(t *testing.T) {
 	resolver := newResolver(t)
-	ips, err := resolver.LookupIP("testnet-seed.stakey.org.")
+	result, err := resolver.LookupIP("testnet-seed.stakey.org.")
 	if err != nil {
 		t.Error("should validate")
 	}
-	if len(ips) < 1 {
+	if len(result.IPs()) < 1 {
 		t.Error("lookup should return results")
 	}
 }
 
 func TestLookupAAAAOnly(t *testing.T) {
 	resolver := newResolver(t)
-	ips, err := resolver.LookupIP("stakey.org.")
+	result, err := resolver.LookupIP("stakey.org.")
 	if err != nil {
 		t.Error("shouldn't return err")
 	}
-	if len(ips) < 1 {
+	if len(result.IPs()) < 1 {
 		t.Error("lookup should return results")
 	}
 }
 
 func TestLookupResourceNotSigned(t *testing.T) {
 	resolver := newResolver(t)
-	ips, err := resolver.LookupIPv4("google.com.")
-	if err != ErrResourceNotSigned {
+	result, err := resolver.LookupIPv4("google.com.")
+	if !errors.Is(err, ErrResourceNotSigned) {
 		t.Errorf("should return ErrResourceNotSigned")
 	}
-	if len(ips) < 1 {
+	if len(result.IPs()) < 1 {
 		t.Error("lookup should return results")
 	}
 }
 
 func TestLookupValid4(t *testing.T) {
 	resolver := newResolver(t)
-	ips, err := resolver.LookupIP("dnssec-deployment.org.")
+	result, err := resolver.LookupIP("dnssec-deployment.org.")
 	if err != nil {
 		t.Error("validation should pass")
 	}
-	if len(ips) < 1 {
+	if len(result.IPs()) < 1 {
 		t.Error("lookup returned no results")
 	}
 }
 
 func TestLookupValid5(t *testing.T) {
 	resolver := newResolver(t)
-	ips, err := resolver.LookupIP("ada.bortzmeyer.org.")
+	result, err := resolver.LookupIP("ada.bortzmeyer.org.")
 	if err != nil {
 		t.Error("validation should pass")
 	}
-	if len(ips) < 1 {
+	if len(result.IPs()) < 1 {
 		t.Error("lookup returned no results")
 	}
 }
 
 func TestLookupInvalidDsDigest(t *testing.T) {
 	resolver := newResolver(t)
-	ips, err := resolver.LookupIPv4("testnet-seed.stakey.org.")
-	if err != ErrDsInvalid {
+	result, err := resolver.LookupIPv4("testnet-seed.stakey.org.")
+	if !errors.Is(err, ErrDsInvalid) {
 		t.Errorf("should return ErrDsInvalid")
 	}
-	if len(ips) > 0 {
+	if len(result.IPs()) > 0 {
 		t.Error("lookup shouldn't return results")
 	}
 }
 
 func TestLookupInvalidDsRrsig(t *testing.T) {
 	resolver := newResolver(t)
-	ips, err := resolver.LookupIPv4("stakey.org.")
-	if err != ErrRrsigValidationError {
+	result, err := resolver.LookupIPv4("stakey.org.")
+	if !errors.Is(err, ErrRrsigValidationError) {
 		t.Error("should return ErrRrsigValidationError")
 	}
-	if len(ips) > 0 {
+	if len(result.IPs()) > 0 {
 		t.Error("lookup returned no results")
 	}
 }
 
 func TestLookupInvalidARRSIG(t *testing.T) {
 	resolver := newResolver(t)
-	ips, err := resolver.LookupIPv4("stakey.org.")
-	if err != ErrInvalidRRsig {
+	result, err := resolver.LookupIPv4("stakey.org.")
+	if !errors.Is(err, ErrInvalidRRsig) {
 		t.Error("should return ErrRrsigValidationError")
 	}
-	if len(ips) > 0 {
+	if len(result.IPs()) > 0 {
 		t.Error("lookup returned no results")
 	}
 }
 
 func TestLookupInvalidAAAARRSIG(t *testing.T) {
 	resolver := newResolver(t)
-	ips, err := resolver.LookupIPv6("stakey.org.")
-	if err != ErrInvalidRRsig {
+	result, err := resolver.LookupIPv6("stakey.org.")
+	if !errors.Is(err, ErrInvalidRRsig) {
 		t.Error("should return ErrRrsigValidationError")
 	}
-	if len(ips) > 0 {
+	if len(result.IPs()) > 0 {
 		t.Error("lookup returned no results")
 	}
 }
 
 func TestLookupInvalidDnskeyRrsig(t *testing.T) {
 	resolver := newResolver(t)
-	ips, err := resolver.LookupIPv4("stakey.org.")
-	if err != ErrRrsigValidationError {
+	result, err := resolver.LookupIPv4("stakey.org.")
+	if !errors.Is(err, ErrRrsigValidationError) {
 		t.Error("should return ErrRrsigValidationError")
 	}
-	if len(ips) > 0 {
+	if len(result.IPs()) > 0 {
 		t.Error("lookup returned no results")
 	}
 }
 
 func TestLookupMissingDnskey(t *testing.T) {
 	resolver := newResolver(t)
-	ips, err := resolver.LookupIPv4("stakey.org.")
-	if err != ErrDnskeyNotAvailable {
+	result, err := resolver.LookupIPv4("stakey.org.")
+	if !errors.Is(err, ErrDnskeyNotAvailable) {
 		t.Error("should return ErrDnskeyNotAvailable")
 	}
-	if len(ips) > 0 {
+	if len(result.IPs()) > 0 {
 		t.Error("lookup returned no results")
 	}
 }
 
 func TestStrictNSQuery(t *testing.T) {
 	resolver := newResolver(t)
-	rrs, err := resolver.StrictNSQuery("bortzmeyer.org.", dns.TypeTXT)
+	result, err := resolver.StrictNSQuery("bortzmeyer.org.", dns.TypeTXT)
 	if err != nil {
 		t.Error("err should be nil")
 	}
-	if len(rrs) != 2 {
+	if len(result.RRs) != 2 {
 		t.Error("should return RRs")
 	}
 }
 
 func TestNonexistentName(t *testing.T) {
 	resolver := newResolver(t)
-	rrs, err := resolver.StrictNSQuery("non-existent-domain-34545345.org.", dns.TypeTXT)
-	if err != ErrNoResult {
-		t.Error("should return ErrNoResult")
+	result, err := resolver.StrictNSQuery("non-existent-domain-34545345.org.", dns.TypeTXT)
+	// The recorded answers from the signed zone have no NSEC records.
+	if !errors.Is(err, ErrNoDenialProof) {
+		t.Error("should return ErrNoDenialProof")
 	}
-	if len(rrs) > 0 {
+	if len(result.RRs) > 0 {
 		t.Error("should not return results")
 	}
 }
 
 func TestOnlyZskPresent(t *testing.T) {
 	resolver := newResolver(t)
-	rrs, err := resolver.StrictNSQuery("froggle.org.", dns.TypeMX)
+	result, err := resolver.StrictNSQuery("froggle.org.", dns.TypeMX)
 	if err != nil {
 		t.Error("should not return err")
 	}
-	if len(rrs) < 7 {
+	if len(result.RRs) < 7 {
 		t.Error("should return results")
 	}
 }
 
 func TestMissingDsRR(t *testing.T) {
 	resolver := newResolver(t)
-	ips, err := resolver.LookupIPv4("dnssec-deployment.org.")
-	if err != ErrDsNotAvailable {
+	result, err := resolver.LookupIPv4("dnssec-deployment.org.")
+	if !errors.Is(err, ErrDsNotAvailable) {
 		t.Error("should return ErrDsNotAvailable")
 	}
-	if len(ips) > 0 {
+	if len(result.IPs()) > 0 {
 		t.Error("should return no results")
 	}
 }
 
 func TestStrictNSQueryEmptyInput(t *testing.T) {
 	resolver := newResolver(t)
-	rrs, err := resolver.StrictNSQuery("", dns.TypeMX)
+	result, err := resolver.StrictNSQuery("", dns.TypeMX)
 	if err == nil {
 		t.Error("should return err")
 	}
-	if len(rrs) > 0 {
+	if len(result.RRs) > 0 {
 		t.Error("shouldn't return results")
 	}
 }
 
+func TestStrictNSQueryPopulateError(t *testing.T) {
+	n := newSignedTestNet(t)
+	resolver := n.newResolver()
+	errTimeout := errors.New("i/o timeout")
+	resolver.queryFn = func(qname string, qtype uint16) (*dns.Msg, error) {
+		if qname == "example.org." && qtype == dns.TypeDNSKEY {
+			return nil, errTimeout
+		}
+		return n.query(qname, qtype)
+	}
+
+	result, err := resolver.StrictNSQuery("www.example.org.", dns.TypeA)
+	if err != errTimeout {
+		t.Error("should return the error of the chain of trust: ", err)
+	}
+	if result.Status == Secure {
+		t.Error("shouldn't be secure")
+	}
+}
+
 func TestForgedRRSIGHeader(t *testing.T) {
 	resolver := newResolver(t)
 	qname := "stakey.org."
@@ -314,11 +345,11 @@ func TestForgedRRSIGHeader(t *testing.T) {
 	answer, _ := resolver.queryRRset(qname, dns.TypeA)
 
 	// forge the RRSIG header
-	answer.rrSig.Header().Name = "forged.org."
+	answer.rrSigs[0].Header().Name = "forged.org."
 
 	err := answer.CheckHeaderIntegrity(qname)
 
-	if err != ErrForgedRRsig {
+	if !errors.Is(err, ErrForgedRRsig) {
 		t.Error("should return ErrForgedRRsig")
 	}
 }
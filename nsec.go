@@ -0,0 +1,408 @@
+package goresolver
+
+import (
+	"log"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// canonicalCompare compares two domain names in the canonical DNS name
+// order (RFC 4034 section 6.1).  It returns -1 if a sorts before b, 1 if
+// it sorts after b and 0 if the names are equal.
+func canonicalCompare(a string, b string) int {
+	aLabels := dns.SplitDomainName(strings.ToLower(a))
+	bLabels := dns.SplitDomainName(strings.ToLower(b))
+	i, j := len(aLabels)-1, len(bLabels)-1
+	for ; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := strings.Compare(aLabels[i], bLabels[j]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case i < 0 && j < 0:
+		return 0
+	case i < 0:
+		return -1
+	}
+	return 1
+}
+
+// hasType returns true if the NSEC/NSEC3 type bitmap contains rrType.
+func hasType(typeBitMap []uint16, rrType uint16) bool {
+	for _, t := range typeBitMap {
+		if t == rrType {
+			return true
+		}
+	}
+	return false
+}
+
+// commonAncestor returns the longest domain name both a and b are
+// equal to or below of.
+func commonAncestor(a string, b string) string {
+	n := dns.CompareDomainName(a, b)
+	labels := dns.SplitDomainName(a)
+	return dns.Fqdn(strings.Join(labels[len(labels)-n:], "."))
+}
+
+// nsecMatches returns true if the owner name of the NSEC is name.
+func nsecMatches(nsec *dns.NSEC, name string) bool {
+	return canonicalCompare(nsec.Hdr.Name, name) == 0
+}
+
+// nsecCovers returns true if name falls between the owner name and the
+// next domain name of the NSEC, i.e. the NSEC proves name does not
+// exist.  The last NSEC of a zone points back to the zone apex.
+func nsecCovers(nsec *dns.NSEC, name string) bool {
+	owner := nsec.Hdr.Name
+	next := nsec.NextDomain
+	if canonicalCompare(owner, next) < 0 {
+		return canonicalCompare(owner, name) < 0 && canonicalCompare(name, next) < 0
+	}
+	return canonicalCompare(owner, name) < 0 || canonicalCompare(name, next) < 0
+}
+
+// nsecIsAncestorDelegation returns true if the NSEC was taken from the
+// parent side of a zone cut (or a DNAME) above name, in which case it
+// cannot prove anything about name (RFC 6840 section 4.1).
+func nsecIsAncestorDelegation(nsec *dns.NSEC, name string) bool {
+	owner := nsec.Hdr.Name
+	if canonicalCompare(owner, name) == 0 || !dns.IsSubDomain(owner, name) {
+		return false
+	}
+	if hasType(nsec.TypeBitMap, dns.TypeDNAME) {
+		return true
+	}
+	return hasType(nsec.TypeBitMap, dns.TypeNS) && !hasType(nsec.TypeBitMap, dns.TypeSOA)
+}
+
+// denialRecords holds the verified NSEC or NSEC3 records of a denial of
+// existence from zone.
+type denialRecords struct {
+	zone  string
+	nsec  []*dns.NSEC
+	nsec3 []*dns.NSEC3
+}
+
+// checkInZone checks that name belongs to the zone of the records.  The
+// records can't deny names outside of it, although the last NSEC of the
+// zone covers every name sorting after it.
+func (d *denialRecords) checkInZone(name string) error {
+	if !dns.IsSubDomain(d.zone, name) {
+		log.Printf("NSEC records of %s cannot deny %s\n", d.zone, name)
+		return ErrNoDenialProof
+	}
+	return nil
+}
+
+// verifyNameError checks that the records prove qname does not exist.
+func (d *denialRecords) verifyNameError(qname string) error {
+	if err := d.checkInZone(qname); err != nil {
+		return err
+	}
+	if len(d.nsec3) > 0 {
+		return verifyNSEC3NameErrorProof(d.zone, qname, d.nsec3)
+	}
+	return verifyNameErrorProof(qname, d.nsec)
+}
+
+// verifyWildcardExpansion checks that the records prove that no closer
+// match for qname than the wildcard at closestEncloser exists, so the
+// answer for qname was legitimately synthesized from the wildcard.
+func (d *denialRecords) verifyWildcardExpansion(qname string, closestEncloser string) error {
+	if len(d.nsec3) > 0 {
+		return verifyNSEC3WildcardProof(qname, closestEncloser, d.nsec3)
+	}
+	return verifyWildcardProof(qname, closestEncloser, d.nsec)
+}
+
+// verifyNoData checks that the records prove qname has no qtype RRs.
+func (d *denialRecords) verifyNoData(qname string, qtype uint16) error {
+	if err := d.checkInZone(qname); err != nil {
+		return err
+	}
+	if len(d.nsec3) > 0 {
+		return verifyNSEC3NoDataProof(d.zone, qname, qtype, d.nsec3)
+	}
+	return verifyNoDataProof(qname, qtype, d.nsec)
+}
+
+// isDelegation returns true if the records prove that name is a zone
+// cut: the NSEC or NSEC3 matching name lists NS, or name is covered by
+// an opt-out NSEC3.  The records have to prove the absence of DS RRs at
+// name first.
+func (d *denialRecords) isDelegation(name string) bool {
+	for _, nsec := range d.nsec {
+		if nsecMatches(nsec, name) {
+			return hasType(nsec.TypeBitMap, dns.TypeNS)
+		}
+	}
+	if len(d.nsec3) > 0 {
+		match := matchingNSEC3(d.nsec3, name)
+		return match == nil || hasType(match.TypeBitMap, dns.TypeNS)
+	}
+	return false
+}
+
+// verifyMissingDS verifies the denial of existence in the empty DS
+// answer for name, a name below z.  It returns ErrInsecureDelegation if
+// name is proven to be an insecure delegation, nil if it is proven not
+// to be a zone cut at all, and the validation error otherwise.
+func (z SignedZone) verifyMissingDS(name string, ds *RRSet) error {
+	if len(ds.denial) < 1 {
+		return ErrNoDenialProof
+	}
+	records, err := z.verifyNSEC(ds.denial)
+	if err != nil {
+		return err
+	}
+	if ds.nameError {
+		return records.verifyNameError(name)
+	}
+	err = records.verifyNoData(name, dns.TypeDS)
+	if err != nil {
+		return err
+	}
+	if records.isDelegation(name) {
+		return ErrInsecureDelegation
+	}
+	return nil
+}
+
+// verifyNSEC verifies the RRSIGs on the NSEC and NSEC3 RRsets of a
+// denial of existence with the keys of the zone, and returns the
+// records.
+func (z SignedZone) verifyNSEC(denial []*RRSet) (*denialRecords, error) {
+	records := &denialRecords{zone: z.zone}
+	for _, nsecSet := range denial {
+		if !nsecSet.IsSigned() || canonicalName(nsecSet.SignerName()) != canonicalName(z.zone) {
+			log.Printf("NSEC RRset is not signed by %s\n", z.zone)
+			return nil, ErrInvalidRRsig
+		}
+		err := z.verifyRRSIG(nsecSet)
+		if err != nil {
+			log.Printf("NSEC RRSIG didn't verify: %s\n", err)
+			return nil, newValidationError(ErrInvalidRRsig, z.zone, 0, nsecSet, err)
+		}
+		for _, rr := range nsecSet.rrSet {
+			if !dns.IsSubDomain(z.zone, rr.Header().Name) {
+				return nil, ErrNoDenialProof
+			}
+			switch t := rr.(type) {
+			case *dns.NSEC:
+				records.nsec = append(records.nsec, t)
+			case *dns.NSEC3:
+				records.nsec3 = append(records.nsec3, t)
+			default:
+				return nil, ErrNoDenialProof
+			}
+		}
+	}
+	return records, nil
+}
+
+// verifyNameErrorProof checks that the NSEC records prove qname does
+// not exist: one of them has to cover qname, and one of them has to
+// cover the wildcard at the closest encloser of qname, which proves
+// the answer could not have been synthesized (RFC 4035 section 5.4).
+func verifyNameErrorProof(qname string, nsecs []*dns.NSEC) error {
+	var cover *dns.NSEC
+	for _, nsec := range nsecs {
+		if nsecMatches(nsec, qname) {
+			log.Printf("NSEC proves %s exists\n", qname)
+			return ErrNoDenialProof
+		}
+		if nsecProvesEmptyNonTerminal(nsec, qname) {
+			log.Printf("NSEC proves %s is an empty non-terminal\n", qname)
+			return ErrNoDenialProof
+		}
+		if nsecCovers(nsec, qname) && !nsecIsAncestorDelegation(nsec, qname) {
+			cover = nsec
+		}
+	}
+	if cover == nil {
+		log.Printf("no NSEC covers %s\n", qname)
+		return ErrNoDenialProof
+	}
+
+	closestEncloser := nsecClosestEncloser(qname, cover)
+	wildcard := "*." + closestEncloser
+	if closestEncloser == "." {
+		wildcard = "*."
+	}
+	for _, nsec := range nsecs {
+		if nsecMatches(nsec, wildcard) {
+			log.Printf("NSEC proves wildcard %s exists\n", wildcard)
+			return ErrNoDenialProof
+		}
+		if nsecCovers(nsec, wildcard) {
+			return nil
+		}
+	}
+	log.Printf("no NSEC covers wildcard %s\n", wildcard)
+	return ErrNoDenialProof
+}
+
+// nsecClosestEncloser returns the closest encloser of qname, the longest
+// existing ancestor of qname, which is an ancestor of either the owner or
+// the next name of the NSEC covering qname.
+func nsecClosestEncloser(qname string, cover *dns.NSEC) string {
+	closestEncloser := commonAncestor(qname, cover.Hdr.Name)
+	if ce := commonAncestor(qname, cover.NextDomain); dns.CountLabel(ce) > dns.CountLabel(closestEncloser) {
+		closestEncloser = ce
+	}
+	return closestEncloser
+}
+
+// verifyWildcardProof checks that an NSEC covers qname and proves that
+// closestEncloser is its closest encloser, i.e. no closer match for
+// qname than the wildcard at closestEncloser exists (RFC 4035 section
+// 5.3.4).
+func verifyWildcardProof(qname string, closestEncloser string, nsecs []*dns.NSEC) error {
+	for _, nsec := range nsecs {
+		if !nsecCovers(nsec, qname) || nsecIsAncestorDelegation(nsec, qname) {
+			continue
+		}
+		if canonicalCompare(nsecClosestEncloser(qname, nsec), closestEncloser) == 0 {
+			return nil
+		}
+	}
+	log.Printf("no NSEC proves %s is the closest encloser of %s\n", closestEncloser, qname)
+	return ErrNoDenialProof
+}
+
+// verifyNoDataProof checks that the NSEC records prove that qname
+// exists, but has no RRs of type qtype (RFC 4035 section 5.4).  An empty
+// non-terminal has no NSEC, it is proven by the NSEC covering it, whose
+// next name is below it (RFC 4035 section 3.1.3.2).
+func verifyNoDataProof(qname string, qtype uint16, nsecs []*dns.NSEC) error {
+	for _, nsec := range nsecs {
+		if nsecMatches(nsec, qname) {
+			return verifyNoDataTypes(qname, qtype, nsec.TypeBitMap)
+		}
+	}
+	for _, nsec := range nsecs {
+		if nsecProvesEmptyNonTerminal(nsec, qname) {
+			return nil
+		}
+	}
+	log.Printf("no NSEC matches %s\n", qname)
+	return ErrNoDenialProof
+}
+
+// nsecProvesEmptyNonTerminal returns true if the NSEC covers name, and
+// its next name is below name, so name exists without RRs.
+func nsecProvesEmptyNonTerminal(nsec *dns.NSEC, name string) bool {
+	return nsecCovers(nsec, name) && dns.IsSubDomain(name, nsec.NextDomain) &&
+		!nsecIsAncestorDelegation(nsec, name)
+}
+
+// verifyNoDataTypes checks the type bitmap of the NSEC or NSEC3 owned by
+// qname: it must list neither qtype nor CNAME.  A record from the parent
+// side of a zone cut only proves the absence of a DS RRset, and one from
+// the child apex cannot prove it.
+func verifyNoDataTypes(qname string, qtype uint16, typeBitMap []uint16) error {
+	if hasType(typeBitMap, qtype) || hasType(typeBitMap, dns.TypeCNAME) {
+		log.Printf("NSEC proves %s %s exists\n", qname, dns.TypeToString[qtype])
+		return ErrNoDenialProof
+	}
+	isDelegation := hasType(typeBitMap, dns.TypeNS) && !hasType(typeBitMap, dns.TypeSOA)
+	if isDelegation && qtype != dns.TypeDS {
+		log.Printf("NSEC at delegation %s cannot prove NODATA\n", qname)
+		return ErrNoDenialProof
+	}
+	if qtype == dns.TypeDS && hasType(typeBitMap, dns.TypeSOA) {
+		log.Printf("NSEC from the child zone %s cannot prove the absence of DS\n", qname)
+		return ErrNoDenialProof
+	}
+	return nil
+}
+
+// verifyDenial checks the denial of existence in an empty answer for
+// qname, or the target of its CNAME RRsets, and qtype.  It returns
+// ErrNxDomain if qname is proven not to exist, ErrNoData if qname is
+// proven to have no qtype RRs, ErrNoResult if the denial is insecure, and
+// the validation error otherwise, along with the validation status of
+// the answer.
+func (resolver *Resolver) verifyDenial(qname string, qtype uint16, answer *RRSet) (ValidationStatus, error) {
+	// The denial is for the target of the CNAME RRsets.
+	qname = answer.owner(qname)
+	if resolver.isNegativeTrustAnchor(qname) {
+		return Insecure, ErrNoResult
+	}
+	if len(answer.denial) < 1 {
+		return resolver.verifyMissingDenial(qname)
+	}
+	if !answer.denial[0].IsSigned() {
+		return Bogus, ErrInvalidRRsig
+	}
+	signerName := answer.denial[0].SignerName()
+	if !dns.IsSubDomain(signerName, qname) {
+		log.Printf("%s cannot deny %s\n", signerName, qname)
+		return Bogus, ErrNoDenialProof
+	}
+
+	authChain := NewAuthenticationChain()
+	err := authChain.Populate(signerName)
+	if err != nil {
+		log.Printf("Cannot populate authentication chain: %s\n", err)
+		return validationStatus(err), err
+	}
+
+	if answer.nameError {
+		status, err := authChain.VerifyNameError(qname, answer.denial)
+		if status == Insecure {
+			return resolver.verifyInsecureDenial(qname)
+		}
+		if err != nil {
+			log.Printf("NXDOMAIN validation failed: %s\n", err)
+			return status, err
+		}
+		return status, ErrNxDomain
+	}
+
+	status, err := authChain.VerifyNoData(qname, qtype, answer.denial)
+	if status == Insecure {
+		return resolver.verifyInsecureDenial(qname)
+	}
+	if err != nil {
+		log.Printf("NODATA validation failed: %s\n", err)
+		return status, err
+	}
+	return status, ErrNoData
+}
+
+// verifyInsecureDenial checks a denial of existence for qname found
+// insecure with the chain of trust of its signer, which is chosen by
+// whoever signed it: it is only insecure, with ErrNoResult, if the chain
+// of trust of qname proves it as well, and bogus otherwise.
+func (resolver *Resolver) verifyInsecureDenial(qname string) (ValidationStatus, error) {
+	if resolver.verifyUnsigned(qname) != ErrInsecureDelegation {
+		log.Printf("%s is not in an insecure zone\n", qname)
+		return Bogus, ErrNoDenialProof
+	}
+	return Insecure, ErrNoResult
+}
+
+// verifyMissingDenial checks an empty answer for qname without NSEC or
+// NSEC3 records.  It is only legitimate if qname is provably in an
+// insecure zone, in which case ErrNoResult is returned; otherwise the
+// answer is bogus and ErrNoDenialProof is returned.
+func (resolver *Resolver) verifyMissingDenial(qname string) (ValidationStatus, error) {
+	authChain := NewAuthenticationChain()
+	err := authChain.Populate(qname)
+	if err != nil {
+		log.Printf("Cannot populate authentication chain: %s\n", err)
+		return validationStatus(err), err
+	}
+	status, err := authChain.VerifyInsecure()
+	if err == ErrInsecureDelegation {
+		return Insecure, ErrNoResult
+	}
+	if status == Indeterminate {
+		return status, err
+	}
+	log.Printf("empty answer for %s without denial of existence\n", qname)
+	return Bogus, ErrNoDenialProof
+}
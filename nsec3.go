@@ -0,0 +1,203 @@
+package goresolver
+
+import (
+	"log"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// MaxNsec3Iterations is the highest number of additional NSEC3 hash
+// iterations accepted.  Computing the hashes of denials using more
+// iterations is too expensive, such denials are treated as insecure
+// (RFC 5155 section 10.3, RFC 9276 section 3.2).
+const MaxNsec3Iterations = 150
+
+// nsec3OptOut is the Opt-Out flag of NSEC3 RRs.
+const nsec3OptOut = 0x01
+
+// nsec3Matches returns true if the owner name of the NSEC3 is the hash of
+// name.
+func nsec3Matches(nsec3 *dns.NSEC3, name string) bool {
+	return nsec3.Match(name)
+}
+
+// nsec3Covers returns true if the hash of name falls between the owner
+// name and the next hashed owner name of the NSEC3, i.e. the NSEC3 proves
+// name does not exist.
+func nsec3Covers(nsec3 *dns.NSEC3, name string) bool {
+	return nsec3.Cover(name) && !nsec3.Match(name)
+}
+
+// checkNSEC3Params checks that all NSEC3 records use the same supported
+// hash algorithm, iterations and salt (RFC 5155 section 8.2).  It
+// returns ErrInsecureDelegation if they use more than MaxNsec3Iterations
+// iterations.
+func checkNSEC3Params(nsec3s []*dns.NSEC3) error {
+	first := nsec3s[0]
+	if first.Hash != dns.SHA1 {
+		log.Printf("unknown NSEC3 hash algorithm %d\n", first.Hash)
+		return ErrNoDenialProof
+	}
+	if first.Iterations > MaxNsec3Iterations {
+		log.Printf("too many NSEC3 iterations (%d)\n", first.Iterations)
+		return ErrInsecureDelegation
+	}
+	for _, nsec3 := range nsec3s[1:] {
+		if nsec3.Hash != first.Hash || nsec3.Iterations != first.Iterations ||
+			!strings.EqualFold(nsec3.Salt, first.Salt) {
+			log.Printf("inconsistent NSEC3 parameters\n")
+			return ErrNoDenialProof
+		}
+	}
+	return nil
+}
+
+// matchingNSEC3 returns the NSEC3 whose owner name is the hash of name,
+// or nil.
+func matchingNSEC3(nsec3s []*dns.NSEC3, name string) *dns.NSEC3 {
+	for _, nsec3 := range nsec3s {
+		if nsec3Matches(nsec3, name) {
+			return nsec3
+		}
+	}
+	return nil
+}
+
+// coveringNSEC3 returns the NSEC3 covering the hash of name, or nil.
+func coveringNSEC3(nsec3s []*dns.NSEC3, name string) *dns.NSEC3 {
+	for _, nsec3 := range nsec3s {
+		if nsec3Covers(nsec3, name) {
+			return nsec3
+		}
+	}
+	return nil
+}
+
+// verifyClosestEncloser checks the closest encloser proof for qname
+// (RFC 5155 section 8.3): an NSEC3 has to match the closest encloser, the
+// longest existing ancestor of qname in zone, and another NSEC3 has to
+// cover the next closer name, the name one label longer than the closest
+// encloser.  It returns the closest encloser and the NSEC3 covering the
+// next closer name.
+func verifyClosestEncloser(zone string, qname string, nsec3s []*dns.NSEC3) (string, *dns.NSEC3, error) {
+	if matchingNSEC3(nsec3s, qname) != nil {
+		log.Printf("NSEC3 proves %s exists\n", qname)
+		return "", nil, ErrNoDenialProof
+	}
+
+	labels := dns.SplitDomainName(qname)
+	for i := 1; i <= len(labels); i++ {
+		closestEncloser := dns.Fqdn(strings.Join(labels[i:], "."))
+		if !dns.IsSubDomain(zone, closestEncloser) {
+			break
+		}
+		match := matchingNSEC3(nsec3s, closestEncloser)
+		if match == nil {
+			continue
+		}
+		if hasType(match.TypeBitMap, dns.TypeDNAME) ||
+			(hasType(match.TypeBitMap, dns.TypeNS) && !hasType(match.TypeBitMap, dns.TypeSOA)) {
+			log.Printf("NSEC3 at delegation %s cannot prove names below it\n", closestEncloser)
+			return "", nil, ErrNoDenialProof
+		}
+		nextCloser := dns.Fqdn(strings.Join(labels[i-1:], "."))
+		cover := coveringNSEC3(nsec3s, nextCloser)
+		if cover == nil {
+			log.Printf("no NSEC3 covers the next closer name %s\n", nextCloser)
+			return "", nil, ErrNoDenialProof
+		}
+		return closestEncloser, cover, nil
+	}
+	log.Printf("no NSEC3 matches the closest encloser of %s\n", qname)
+	return "", nil, ErrNoDenialProof
+}
+
+// verifyNSEC3NameErrorProof checks that the NSEC3 records prove qname
+// does not exist: the closest encloser proof for qname, and an NSEC3
+// covering the wildcard at the closest encloser (RFC 5155 section 8.4).
+func verifyNSEC3NameErrorProof(zone string, qname string, nsec3s []*dns.NSEC3) error {
+	err := checkNSEC3Params(nsec3s)
+	if err != nil {
+		return err
+	}
+	closestEncloser, _, err := verifyClosestEncloser(zone, qname, nsec3s)
+	if err != nil {
+		return err
+	}
+	wildcard := "*." + strings.TrimPrefix(closestEncloser, ".")
+	if coveringNSEC3(nsec3s, wildcard) == nil {
+		log.Printf("no NSEC3 covers wildcard %s\n", wildcard)
+		return ErrNoDenialProof
+	}
+	return nil
+}
+
+// verifyNSEC3WildcardProof checks that an NSEC3 covers the next closer
+// name of qname below closestEncloser, which proves that no closer match
+// for qname than the wildcard at closestEncloser exists (RFC 5155
+// section 8.8).
+func verifyNSEC3WildcardProof(qname string, closestEncloser string, nsec3s []*dns.NSEC3) error {
+	err := checkNSEC3Params(nsec3s)
+	if err != nil {
+		return err
+	}
+	labels := dns.SplitDomainName(qname)
+	nextCloser := dns.Fqdn(strings.Join(labels[len(labels)-dns.CountLabel(closestEncloser)-1:], "."))
+	if coveringNSEC3(nsec3s, nextCloser) == nil {
+		log.Printf("no NSEC3 covers the next closer name %s\n", nextCloser)
+		return ErrNoDenialProof
+	}
+	return nil
+}
+
+// verifyNSEC3OptOutProof checks that the NSEC3 records prove there is
+// no signed delegation to zone: the closest encloser proof for zone,
+// where the NSEC3 covering the next closer name has the Opt-Out flag set
+// (RFC 5155 section 8.6).  Such a delegation, if it exists, is insecure.
+func verifyNSEC3OptOutProof(parentZone string, zone string, nsec3s []*dns.NSEC3) error {
+	err := checkNSEC3Params(nsec3s)
+	if err != nil {
+		return err
+	}
+	_, cover, err := verifyClosestEncloser(parentZone, zone, nsec3s)
+	if err != nil {
+		return err
+	}
+	if cover.Flags&nsec3OptOut == 0 {
+		log.Printf("NSEC3 covering %s is not opt-out\n", zone)
+		return ErrNoDenialProof
+	}
+	return nil
+}
+
+// verifyNSEC3NoDataProof checks that the NSEC3 records prove qname has
+// no RRs of type qtype: either the NSEC3 matching qname doesn't list
+// qtype (RFC 5155 section 8.5), or qname doesn't exist and the NSEC3
+// matching the wildcard at its closest encloser doesn't list qtype
+// (RFC 5155 section 8.7).  A DS RR may also be denied by an opt-out
+// NSEC3 covering qname.
+func verifyNSEC3NoDataProof(zone string, qname string, qtype uint16, nsec3s []*dns.NSEC3) error {
+	err := checkNSEC3Params(nsec3s)
+	if err != nil {
+		return err
+	}
+	if match := matchingNSEC3(nsec3s, qname); match != nil {
+		return verifyNoDataTypes(qname, qtype, match.TypeBitMap)
+	}
+	if qtype == dns.TypeDS {
+		return verifyNSEC3OptOutProof(zone, qname, nsec3s)
+	}
+
+	closestEncloser, _, err := verifyClosestEncloser(zone, qname, nsec3s)
+	if err != nil {
+		return err
+	}
+	wildcard := "*." + strings.TrimPrefix(closestEncloser, ".")
+	match := matchingNSEC3(nsec3s, wildcard)
+	if match == nil {
+		log.Printf("no NSEC3 matches wildcard %s\n", wildcard)
+		return ErrNoDenialProof
+	}
+	return verifyNoDataTypes(wildcard, qtype, match.TypeBitMap)
+}
@@ -0,0 +1,200 @@
+package goresolver
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func newNSEC3TestNet(t *testing.T) *testNet {
+	n := newSignedTestNet(t)
+	for _, z := range n.zones {
+		z.nsec3 = &dns.NSEC3PARAM{Hash: dns.SHA1, Iterations: 5, Salt: "AABBCCDD"}
+	}
+	return n
+}
+
+func TestNSEC3NameErrorProven(t *testing.T) {
+	resolver := newNSEC3TestNet(t).newResolver()
+
+	if _, err := resolver.StrictNSQuery("nonexistent.example.org.", dns.TypeTXT); !errors.Is(err, ErrNxDomain) {
+		t.Error("should return ErrNxDomain: ", err)
+	}
+	if _, err := resolver.LookupIPv4("a.b.example.org."); !errors.Is(err, ErrNxDomain) {
+		t.Error("should return ErrNxDomain: ", err)
+	}
+	if _, err := resolver.LookupIP("nonexistent.org."); !errors.Is(err, ErrNxDomain) {
+		t.Error("should return ErrNxDomain: ", err)
+	}
+}
+
+func TestNSEC3NoDataProven(t *testing.T) {
+	resolver := newNSEC3TestNet(t).newResolver()
+
+	if _, err := resolver.StrictNSQuery("www.example.org.", dns.TypeTXT); !errors.Is(err, ErrNoData) {
+		t.Error("should return ErrNoData: ", err)
+	}
+	if _, err := resolver.LookupIPv6("www.example.org."); !errors.Is(err, ErrNoData) {
+		t.Error("should return ErrNoData: ", err)
+	}
+}
+
+func TestNSEC3WildcardNoData(t *testing.T) {
+	n := newNSEC3TestNet(t)
+	example := n.zones["example.org."]
+	example.add(t, "*.example.org. 300 IN TXT \"wildcard\"")
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "any.example.org." {
+			msg.Rcode = dns.RcodeSuccess
+			msg.Ns = example.denial(t, "example.org.", "any.example.org.", "*.example.org.")
+		}
+	}
+	resolver := n.newResolver()
+	if _, err := resolver.StrictNSQuery("any.example.org.", dns.TypeA); !errors.Is(err, ErrNoData) {
+		t.Error("should return ErrNoData: ", err)
+	}
+	if _, err := resolver.StrictNSQuery("any.example.org.", dns.TypeTXT); !errors.Is(err, ErrNoDenialProof) {
+		t.Error("wildcard TXT exists: ", err)
+	}
+}
+
+func TestNSEC3NameErrorNextCloserNotCovered(t *testing.T) {
+	n := newNSEC3TestNet(t)
+	example := n.zones["example.org."]
+
+	// Pick a name whose hash isn't covered by the wildcard NSEC3.
+	qname := "nonexistent.example.org."
+	wildcardOwner := example.coveringNSEC3("*.example.org.").Hdr.Name
+	for example.coveringNSEC3(qname).Hdr.Name == wildcardOwner {
+		qname = "x" + qname
+	}
+	n.tamper = func(name string, qtype uint16, msg *dns.Msg) {
+		if name == qname {
+			// Omit the NSEC3 covering the next closer name.
+			msg.Ns = example.denial(t, "example.org.", "*.example.org.")
+		}
+	}
+	resolver := n.newResolver()
+	if _, err := resolver.StrictNSQuery(qname, dns.TypeA); !errors.Is(err, ErrNoDenialProof) {
+		t.Error("should return ErrNoDenialProof: ", err)
+	}
+}
+
+func TestNSEC3NameErrorReplayed(t *testing.T) {
+	n := newNSEC3TestNet(t)
+	example := n.zones["example.org."]
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "www.example.org." {
+			msg.Answer = nil
+			msg.Rcode = dns.RcodeNameError
+			msg.Ns = example.nameErrorDenial(t, "zzz.example.org.")
+		}
+	}
+	resolver := n.newResolver()
+	if _, err := resolver.LookupIPv4("www.example.org."); !errors.Is(err, ErrNoDenialProof) {
+		t.Error("should return ErrNoDenialProof: ", err)
+	}
+}
+
+func TestNSEC3NoDataTypeInBitmap(t *testing.T) {
+	n := newNSEC3TestNet(t)
+	example := n.zones["example.org."]
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "www.example.org." && qtype == dns.TypeA {
+			msg.Answer = nil
+			msg.Ns = example.denial(t, qname)
+		}
+	}
+	resolver := n.newResolver()
+	if _, err := resolver.StrictNSQuery("www.example.org.", dns.TypeA); !errors.Is(err, ErrNoDenialProof) {
+		t.Error("should return ErrNoDenialProof: ", err)
+	}
+}
+
+func TestNSEC3UnsupportedParams(t *testing.T) {
+	n := newNSEC3TestNet(t)
+	n.zones["example.org."].nsec3.Iterations = MaxNsec3Iterations + 1
+	resolver := n.newResolver()
+	result, err := resolver.StrictNSQuery("nonexistent.example.org.", dns.TypeA)
+	if err != ErrNoResult || result.Status != Insecure {
+		t.Error("too many iterations should be insecure: ", err)
+	}
+	result, err = resolver.StrictNSQuery("www.example.org.", dns.TypeTXT)
+	if err != ErrNoResult || result.Status != Insecure {
+		t.Error("too many iterations should be insecure: ", err)
+	}
+}
+
+func TestNSEC3Forged(t *testing.T) {
+	n := newNSEC3TestNet(t)
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		for _, rr := range msg.Ns {
+			if nsec3, ok := rr.(*dns.NSEC3); ok {
+				nsec3.TypeBitMap = []uint16{dns.TypeNS}
+			}
+		}
+	}
+	resolver := n.newResolver()
+	if _, err := resolver.StrictNSQuery("www.example.org.", dns.TypeTXT); !errors.Is(err, ErrInvalidRRsig) {
+		t.Error("should return ErrInvalidRRsig: ", err)
+	}
+}
+
+func newOptOutTestNet(t *testing.T) *testNet {
+	n := newNSEC3TestNet(t)
+	n.zones["org."].nsec3.Flags = nsec3OptOut
+	child := n.addZone("child.org.")
+	child.add(t, "www.child.org. 300 IN A 192.0.2.2")
+	return n
+}
+
+func TestNSEC3OptOutInsecureDelegation(t *testing.T) {
+	n := newOptOutTestNet(t)
+	n.zones["org."].remove("child.org.", dns.TypeDS)
+	resolver := n.newResolver()
+
+	result, err := resolver.LookupIPv4("www.child.org.")
+	if err != nil || result.Status != Insecure {
+		t.Error("should be insecure: ", err)
+	}
+	if len(result.IPs()) != 1 {
+		t.Error("lookup should return results")
+	}
+	if _, err := resolver.StrictNSQuery("child.org.", dns.TypeDS); !errors.Is(err, ErrNoData) {
+		t.Error("should return ErrNoData: ", err)
+	}
+	if _, err := resolver.LookupIPv4("www.example.org."); err != nil {
+		t.Error("signed delegations should validate: ", err)
+	}
+}
+
+func TestNSEC3InsecureDelegation(t *testing.T) {
+	n := newOptOutTestNet(t)
+	n.zones["org."].nsec3.Flags = 0
+	n.zones["org."].remove("child.org.", dns.TypeDS)
+	resolver := n.newResolver()
+
+	result, err := resolver.LookupIPv4("www.child.org.")
+	if err != nil || result.Status != Insecure {
+		t.Error("NSEC3 matching the delegation should prove it insecure: ", err)
+	}
+	if len(result.IPs()) != 1 {
+		t.Error("lookup should return results")
+	}
+}
+
+func TestNSEC3OptOutStrippedDS(t *testing.T) {
+	n := newOptOutTestNet(t)
+	org := n.zones["org."]
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "child.org." && qtype == dns.TypeDS {
+			msg.Answer = nil
+			msg.Ns = org.denial(t, "org.", "child.org.")
+		}
+	}
+	resolver := n.newResolver()
+	if _, err := resolver.LookupIPv4("www.child.org."); !errors.Is(err, ErrDsNotAvailable) {
+		t.Error("should return ErrDsNotAvailable: ", err)
+	}
+}
@@ -0,0 +1,324 @@
+package goresolver
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestCanonicalCompare(t *testing.T) {
+	// RFC 4034 section 6.1
+	ordered := []string{
+		"example.",
+		"a.example.",
+		"yljkjljk.a.example.",
+		"Z.a.example.",
+		"zABC.a.EXAMPLE.",
+		"z.example.",
+		"*.z.example.",
+	}
+	for i := 0; i < len(ordered)-1; i++ {
+		if canonicalCompare(ordered[i], ordered[i+1]) >= 0 {
+			t.Errorf("%s should sort before %s", ordered[i], ordered[i+1])
+		}
+		if canonicalCompare(ordered[i+1], ordered[i]) <= 0 {
+			t.Errorf("%s should sort after %s", ordered[i+1], ordered[i])
+		}
+	}
+	if canonicalCompare("Example.ORG.", "example.org.") != 0 {
+		t.Error("comparison should be case insensitive")
+	}
+}
+
+func TestNsecCovers(t *testing.T) {
+	nsec := &dns.NSEC{Hdr: dns.RR_Header{Name: "a.example."}, NextDomain: "d.example."}
+	last := &dns.NSEC{Hdr: dns.RR_Header{Name: "z.example."}, NextDomain: "example."}
+	tests := []struct {
+		nsec  *dns.NSEC
+		name  string
+		cover bool
+	}{
+		{nsec, "b.example.", true},
+		{nsec, "x.b.example.", true},
+		{nsec, "a.example.", false},
+		{nsec, "d.example.", false},
+		{nsec, "e.example.", false},
+		{last, "zz.example.", true},
+		{last, "a.z.example.", true},
+		{last, "b.example.", false},
+	}
+	for _, test := range tests {
+		if nsecCovers(test.nsec, test.name) != test.cover {
+			t.Errorf("%s covering %s should be %v", test.nsec.Hdr.Name, test.name, test.cover)
+		}
+	}
+}
+
+func TestNameErrorProven(t *testing.T) {
+	resolver := newSignedTestNet(t).newResolver()
+
+	result, err := resolver.StrictNSQuery("nonexistent.example.org.", dns.TypeTXT)
+	if !errors.Is(err, ErrNxDomain) {
+		t.Error("should return ErrNxDomain: ", err)
+	}
+	if len(result.RRs) > 0 {
+		t.Error("should not return results")
+	}
+	if _, err := resolver.LookupIPv4("zzz.example.org."); !errors.Is(err, ErrNxDomain) {
+		t.Error("should return ErrNxDomain: ", err)
+	}
+	if _, err := resolver.LookupIP("a.b.example.org."); !errors.Is(err, ErrNxDomain) {
+		t.Error("should return ErrNxDomain: ", err)
+	}
+}
+
+func TestNameErrorForged(t *testing.T) {
+	n := newSignedTestNet(t)
+	example := n.zones["example.org."]
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "www.example.org." {
+			// Replay a valid denial of another name.
+			msg.Answer = nil
+			msg.Rcode = dns.RcodeNameError
+			msg.Ns = example.denial(t, "zzz.example.org.", "*.example.org.")
+		}
+	}
+	resolver := n.newResolver()
+	if _, err := resolver.LookupIPv4("www.example.org."); !errors.Is(err, ErrNoDenialProof) {
+		t.Error("should return ErrNoDenialProof: ", err)
+	}
+}
+
+func TestNameErrorOutsideZone(t *testing.T) {
+	n := newSignedTestNet(t)
+	// The last NSEC of example.org. covers zzz.org. and *.org.
+	denial := n.zones["example.org."].denial(t, "zzz.org.")
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "zzz.org." {
+			msg.Ns = denial
+		}
+	}
+	resolver := n.newResolver()
+	result, err := resolver.StrictNSQuery("zzz.org.", dns.TypeA)
+	if !errors.Is(err, ErrNoDenialProof) || result.Status != Bogus {
+		t.Error("NSEC of another zone shouldn't deny the name: ", err)
+	}
+
+	authChain := NewAuthenticationChain()
+	if err := authChain.Populate("example.org."); err != nil {
+		t.Fatal("cannot populate the chain of trust: ", err)
+	}
+	status, err := authChain.VerifyNameError("zzz.org.", denialRRsets(denial))
+	if !errors.Is(err, ErrNoDenialProof) || status != Bogus {
+		t.Error("NSEC of another zone shouldn't deny the name: ", err)
+	}
+	status, err = authChain.VerifyNoData("zzz.org.", dns.TypeA, denialRRsets(denial))
+	if !errors.Is(err, ErrNoDenialProof) || status != Bogus {
+		t.Error("NSEC of another zone shouldn't deny the type: ", err)
+	}
+}
+
+func TestVerifyDenialEmpty(t *testing.T) {
+	newSignedTestNet(t).newResolver()
+	authChain := NewAuthenticationChain()
+	if err := authChain.Populate("example.org."); err != nil {
+		t.Fatal("cannot populate the chain of trust: ", err)
+	}
+	if status, err := authChain.VerifyNameError("zzz.example.org.", nil); err != ErrNoDenialProof || status != Bogus {
+		t.Error("should return ErrNoDenialProof: ", err)
+	}
+	if status, err := authChain.VerifyNoData("www.example.org.", dns.TypeTXT, nil); err != ErrNoDenialProof || status != Bogus {
+		t.Error("should return ErrNoDenialProof: ", err)
+	}
+}
+
+func TestNameErrorWildcardNotDenied(t *testing.T) {
+	n := newSignedTestNet(t)
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		// Drop the NSEC covering the wildcard.
+		ns := msg.Ns[:0]
+		for _, rr := range msg.Ns {
+			if rr.Header().Name != "example.org." || rr.Header().Rrtype == dns.TypeSOA {
+				ns = append(ns, rr)
+			}
+		}
+		msg.Ns = ns
+	}
+	resolver := n.newResolver()
+	if _, err := resolver.StrictNSQuery("zzz.example.org.", dns.TypeA); !errors.Is(err, ErrNoDenialProof) {
+		t.Error("should return ErrNoDenialProof: ", err)
+	}
+}
+
+func TestNameErrorUnsignedNSEC(t *testing.T) {
+	n := newSignedTestNet(t)
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		ns := msg.Ns[:0]
+		for _, rr := range msg.Ns {
+			if sig, ok := rr.(*dns.RRSIG); !ok || sig.TypeCovered != dns.TypeNSEC {
+				ns = append(ns, rr)
+			}
+		}
+		msg.Ns = ns
+	}
+	resolver := n.newResolver()
+	if _, err := resolver.StrictNSQuery("nonexistent.example.org.", dns.TypeA); !errors.Is(err, ErrInvalidRRsig) {
+		t.Error("should return ErrInvalidRRsig: ", err)
+	}
+}
+
+func TestNameErrorWithoutNSEC(t *testing.T) {
+	n := newSignedTestNet(t)
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		msg.Ns = nil
+	}
+	resolver := n.newResolver()
+	result, err := resolver.StrictNSQuery("nonexistent.example.org.", dns.TypeA)
+	if !errors.Is(err, ErrNoDenialProof) {
+		t.Error("should return ErrNoDenialProof: ", err)
+	}
+	if result.Status != Bogus || result.ExtendedError == nil || result.ExtendedError.InfoCode != EDENsecMissing {
+		t.Error("NXDOMAIN without NSEC in a secure zone should be bogus: ", result.Status, result.ExtendedError)
+	}
+}
+
+func TestNameErrorInsecureZone(t *testing.T) {
+	resolver := newInsecureTestNet(t).newResolver()
+
+	result, err := resolver.StrictNSQuery("nonexistent.unsigned.org.", dns.TypeA)
+	if !errors.Is(err, ErrNoResult) || result.Status != Insecure {
+		t.Error("NXDOMAIN without NSEC in an insecure zone should be insecure: ", err, result.Status)
+	}
+	result, err = resolver.StrictNSQuery("www.unsigned.org.", dns.TypeTXT)
+	if !errors.Is(err, ErrNoResult) || result.Status != Insecure {
+		t.Error("NODATA without NSEC in an insecure zone should be insecure: ", err, result.Status)
+	}
+}
+
+func TestNameErrorAncestorDelegation(t *testing.T) {
+	n := newSignedTestNet(t)
+	n.zones["example.org."].add(t, "sub.example.org. 3600 IN NS ns.sub.example.org.")
+	resolver := n.newResolver()
+	if _, err := resolver.StrictNSQuery("www.sub.example.org.", dns.TypeA); !errors.Is(err, ErrNoDenialProof) {
+		t.Error("NSEC at a delegation shouldn't prove names below it: ", err)
+	}
+}
+
+func TestNoDataEmptyNonTerminal(t *testing.T) {
+	n := newSignedTestNet(t)
+	sub := n.addZone("sub.ent.example.org.")
+	sub.add(t, "www.sub.ent.example.org. 300 IN A 192.0.2.5")
+	resolver := n.newResolver()
+
+	result, err := resolver.StrictNSQuery("ent.example.org.", dns.TypeA)
+	if !errors.Is(err, ErrNoData) || result.Status != Secure {
+		t.Error("NSEC covering an empty non-terminal should prove NODATA: ", err)
+	}
+	result, err = resolver.LookupIPv4("www.sub.ent.example.org.")
+	if err != nil || result.Status != Secure || len(result.IPs()) != 1 {
+		t.Error("chain of trust through an empty non-terminal should validate: ", err)
+	}
+
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "ent.example.org." {
+			msg.Rcode = dns.RcodeNameError
+		}
+	}
+	if _, err := resolver.StrictNSQuery("ent.example.org.", dns.TypeA); !errors.Is(err, ErrNoDenialProof) {
+		t.Error("an empty non-terminal shouldn't be denied: ", err)
+	}
+}
+
+func TestNoDataProven(t *testing.T) {
+	resolver := newSignedTestNet(t).newResolver()
+
+	result, err := resolver.StrictNSQuery("www.example.org.", dns.TypeTXT)
+	if !errors.Is(err, ErrNoData) {
+		t.Error("should return ErrNoData: ", err)
+	}
+	if len(result.RRs) > 0 {
+		t.Error("should not return results")
+	}
+	if _, err := resolver.LookupIPv6("www.example.org."); !errors.Is(err, ErrNoData) {
+		t.Error("should return ErrNoData: ", err)
+	}
+	if _, err := resolver.StrictNSQuery("example.org.", dns.TypeMX); !errors.Is(err, ErrNoData) {
+		t.Error("should return ErrNoData at the apex: ", err)
+	}
+}
+
+func TestNoDataLookupIP(t *testing.T) {
+	n := newSignedTestNet(t)
+	n.zones["example.org."].add(t, "mail.example.org. 300 IN TXT \"v=spf1 -all\"")
+	resolver := n.newResolver()
+	if _, err := resolver.LookupIP("mail.example.org."); !errors.Is(err, ErrNoData) {
+		t.Error("should return ErrNoData: ", err)
+	}
+}
+
+func TestNoDataTypeInBitmap(t *testing.T) {
+	n := newSignedTestNet(t)
+	example := n.zones["example.org."]
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "www.example.org." && qtype == dns.TypeA {
+			// Strip the answer, keeping the NSEC that lists the A RRset.
+			msg.Answer = nil
+			msg.Ns = example.denial(t, qname)
+		}
+	}
+	resolver := n.newResolver()
+	if _, err := resolver.StrictNSQuery("www.example.org.", dns.TypeA); !errors.Is(err, ErrNoDenialProof) {
+		t.Error("should return ErrNoDenialProof: ", err)
+	}
+}
+
+func TestNoDataCNAMEInBitmap(t *testing.T) {
+	n := newSignedTestNet(t)
+	n.zones["example.org."].add(t, "alias.example.org. 300 IN CNAME www.example.org.")
+	resolver := n.newResolver()
+	if _, err := resolver.StrictNSQuery("alias.example.org.", dns.TypeA); !errors.Is(err, ErrNoDenialProof) {
+		t.Error("NSEC listing CNAME shouldn't prove NODATA: ", err)
+	}
+}
+
+func TestNoDataWrongOwner(t *testing.T) {
+	n := newSignedTestNet(t)
+	example := n.zones["example.org."]
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "www.example.org." && qtype == dns.TypeTXT {
+			msg.Ns = example.denial(t, "example.org.")
+		}
+	}
+	resolver := n.newResolver()
+	if _, err := resolver.StrictNSQuery("www.example.org.", dns.TypeTXT); !errors.Is(err, ErrNoDenialProof) {
+		t.Error("should return ErrNoDenialProof: ", err)
+	}
+}
+
+func TestNoDataAtDelegation(t *testing.T) {
+	n := newSignedTestNet(t)
+	n.zones["example.org."].add(t, "sub.example.org. 3600 IN NS ns.sub.example.org.")
+	resolver := n.newResolver()
+	if _, err := resolver.StrictNSQuery("sub.example.org.", dns.TypeTXT); !errors.Is(err, ErrNoDenialProof) {
+		t.Error("NSEC at a delegation should only prove the absence of DS: ", err)
+	}
+	if _, err := resolver.StrictNSQuery("sub.example.org.", dns.TypeDS); !errors.Is(err, ErrNoData) {
+		t.Error("should return ErrNoData: ", err)
+	}
+}
+
+func TestNoDataUnverified(t *testing.T) {
+	n := newSignedTestNet(t)
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		msg.Ns = nil
+	}
+	resolver := n.newResolver()
+	result, err := resolver.StrictNSQuery("www.example.org.", dns.TypeTXT)
+	if !errors.Is(err, ErrNoDenialProof) {
+		t.Error("should return ErrNoDenialProof: ", err)
+	}
+	if result.Status != Bogus {
+		t.Error("NODATA without NSEC in a secure zone should be bogus: ", result.Status)
+	}
+}
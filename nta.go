@@ -0,0 +1,78 @@
+package goresolver
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// negativeTrustAnchors holds the domains for which DNSSEC validation is
+// disabled, along with the expiration time of each entry.
+//
+// https://tools.ietf.org/html/rfc7646
+type negativeTrustAnchors struct {
+	mu      sync.RWMutex
+	entries map[string]time.Time
+}
+
+// AddNegativeTrustAnchor disables DNSSEC validation for domain and
+// all names below it until expires.  Answers for such names are
+// treated as insecure, rather than failing validation.
+func (resolver *Resolver) AddNegativeTrustAnchor(domain string, expires time.Time) {
+	resolver.ntas.mu.Lock()
+	defer resolver.ntas.mu.Unlock()
+	if resolver.ntas.entries == nil {
+		resolver.ntas.entries = make(map[string]time.Time)
+	}
+	resolver.ntas.entries[canonicalName(domain)] = expires
+}
+
+// RemoveNegativeTrustAnchor re-enables DNSSEC validation for domain.
+func (resolver *Resolver) RemoveNegativeTrustAnchor(domain string) {
+	resolver.ntas.mu.Lock()
+	defer resolver.ntas.mu.Unlock()
+	delete(resolver.ntas.entries, canonicalName(domain))
+}
+
+// NegativeTrustAnchors returns the configured negative trust anchors
+// that have not expired yet, along with their expiration time.
+func (resolver *Resolver) NegativeTrustAnchors() map[string]time.Time {
+	resolver.ntas.mu.RLock()
+	defer resolver.ntas.mu.RUnlock()
+	now := resolver.now()
+	ntas := make(map[string]time.Time, len(resolver.ntas.entries))
+	for domain, expires := range resolver.ntas.entries {
+		if now.Before(expires) {
+			ntas[domain] = expires
+		}
+	}
+	return ntas
+}
+
+// isNegativeTrustAnchor returns true if qname is at or below an
+// unexpired negative trust anchor.  Expired entries are removed.
+func (resolver *Resolver) isNegativeTrustAnchor(qname string) bool {
+	resolver.ntas.mu.Lock()
+	defer resolver.ntas.mu.Unlock()
+	now := resolver.now()
+	qname = canonicalName(qname)
+	for domain, expires := range resolver.ntas.entries {
+		if !now.Before(expires) {
+			delete(resolver.ntas.entries, domain)
+			continue
+		}
+		if dns.IsSubDomain(domain, qname) {
+			log.Printf("%s is under negative trust anchor %s, skipping validation\n", qname, domain)
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalName returns the lower case, fully qualified form of name.
+func canonicalName(name string) string {
+	return strings.ToLower(dns.Fqdn(name))
+}
@@ -0,0 +1,85 @@
+package goresolver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// newBrokenTestNet returns test zones where example.org. has expired
+// signatures and other.org. publishes a DS that does not match its key.
+func newBrokenTestNet(t *testing.T) *testNet {
+	n := newTestNet(t, ".", "org.", "example.org.", "other.org.")
+	example := n.zones["example.org."]
+	example.add(t, "www.example.org. 300 IN A 192.0.2.1")
+	example.add(t, "www.example.org. 300 IN TXT \"broken\"")
+	example.inception = time.Now().Add(-48 * time.Hour)
+	example.expiration = time.Now().Add(-24 * time.Hour)
+
+	other := n.zones["other.org."]
+	other.add(t, "www.other.org. 300 IN A 192.0.2.2")
+	other.ksk, other.kskSigner = n.newKey("other.org.", 257)
+	other.rrs[0] = other.ksk
+	return n
+}
+
+func TestNegativeTrustAnchorBrokenZone(t *testing.T) {
+	resolver := newBrokenTestNet(t).newResolver()
+	if _, err := resolver.LookupIPv4("www.example.org."); err == nil {
+		t.Error("expired signatures shouldn't validate")
+	}
+	if _, err := resolver.LookupIPv4("www.other.org."); err == nil {
+		t.Error("mismatching DS shouldn't validate")
+	}
+}
+
+func TestNegativeTrustAnchor(t *testing.T) {
+	resolver := newBrokenTestNet(t).newResolver()
+	resolver.AddNegativeTrustAnchor("Example.ORG", time.Now().Add(time.Hour))
+
+	result, err := resolver.LookupIPv4("www.example.org.")
+	if err != nil {
+		t.Error("names under a negative trust anchor should be insecure: ", err)
+	}
+	if len(result.IPs()) != 1 {
+		t.Error("lookup should return results")
+	}
+	result, err = resolver.LookupIP("www.example.org.")
+	if err != nil || len(result.IPs()) != 1 {
+		t.Error("LookupIP should return insecure results")
+	}
+	result, err = resolver.StrictNSQuery("www.example.org.", dns.TypeTXT)
+	if err != nil || len(result.RRs) != 1 {
+		t.Error("StrictNSQuery should return insecure results")
+	}
+
+	// Everything else is still validated.
+	if _, err := resolver.LookupIPv4("www.other.org."); err == nil {
+		t.Error("zones outside the negative trust anchor should be validated")
+	}
+}
+
+func TestNegativeTrustAnchorExpired(t *testing.T) {
+	resolver := newBrokenTestNet(t).newResolver()
+	resolver.AddNegativeTrustAnchor("example.org.", time.Now().Add(-time.Second))
+
+	if _, err := resolver.LookupIPv4("www.example.org."); err == nil {
+		t.Error("expired negative trust anchors should be ignored")
+	}
+	if len(resolver.NegativeTrustAnchors()) > 0 {
+		t.Error("expired negative trust anchors shouldn't be returned")
+	}
+}
+
+func TestRemoveNegativeTrustAnchor(t *testing.T) {
+	resolver := newBrokenTestNet(t).newResolver()
+	resolver.AddNegativeTrustAnchor("example.org.", time.Now().Add(time.Hour))
+	if len(resolver.NegativeTrustAnchors()) != 1 {
+		t.Error("should return the negative trust anchor")
+	}
+	resolver.RemoveNegativeTrustAnchor("example.org")
+	if _, err := resolver.LookupIPv4("www.example.org."); err == nil {
+		t.Error("removed negative trust anchors should be ignored")
+	}
+}
@@ -0,0 +1,391 @@
+package goresolver
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Timers of the RFC 5011 trust anchor state machine.
+const (
+	AddHoldDown    = 30 * 24 * time.Hour
+	RemoveHoldDown = 30 * 24 * time.Hour
+)
+
+// KeyState is the RFC 5011 state of a managed trust anchor key.
+type KeyState string
+
+// States of a managed trust anchor key.  Keys in the Start and Removed
+// states are not stored.
+const (
+	KeyStateAddPend KeyState = "AddPend"
+	KeyStateValid   KeyState = "Valid"
+	KeyStateMissing KeyState = "Missing"
+	KeyStateRevoked KeyState = "Revoked"
+)
+
+// ManagedKey is a root zone SEP key tracked by ManagedTrustAnchors.
+type ManagedKey struct {
+	DNSKEY    *dns.DNSKEY
+	State     KeyState
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Changed   time.Time
+}
+
+// ManagedTrustAnchors implements automated updates of the root zone
+// trust anchors (RFC 5011).  The state of the tracked keys is persisted
+// to fileName, so the add and remove hold-down timers survive restarts.
+//
+// https://tools.ietf.org/html/rfc5011
+type ManagedTrustAnchors struct {
+	mu          sync.Mutex
+	fileName    string
+	initial     []*dns.DS
+	keys        []*ManagedKey
+	lastRefresh time.Time
+}
+
+type managedKeyJSON struct {
+	DNSKEY    string    `json:"dnskey"`
+	State     KeyState  `json:"state"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Changed   time.Time `json:"changed"`
+}
+
+type managedTrustAnchorsJSON struct {
+	LastRefresh time.Time        `json:"lastRefresh"`
+	Keys        []managedKeyJSON `json:"keys"`
+}
+
+// NewManagedTrustAnchors loads the managed trust anchor state from
+// fileName.  If the file does not exist yet, the state is bootstrapped
+// on the first refresh using the initial DS trust anchors.
+func NewManagedTrustAnchors(fileName string, initial []*dns.DS) (*ManagedTrustAnchors, error) {
+	m := &ManagedTrustAnchors{
+		fileName: fileName,
+		initial:  initial,
+	}
+	buf, err := os.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state managedTrustAnchorsJSON
+	if err := json.Unmarshal(buf, &state); err != nil {
+		return nil, err
+	}
+	m.lastRefresh = state.LastRefresh
+	for _, k := range state.Keys {
+		rr, err := dns.NewRR(k.DNSKEY)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := rr.(*dns.DNSKEY)
+		if !ok {
+			return nil, ErrInvalidTrustAnchor
+		}
+		m.keys = append(m.keys, &ManagedKey{
+			DNSKEY:    key,
+			State:     k.State,
+			FirstSeen: k.FirstSeen,
+			LastSeen:  k.LastSeen,
+			Changed:   k.Changed,
+		})
+	}
+	return m, nil
+}
+
+// Save writes the managed trust anchor state to the state file.
+func (m *ManagedTrustAnchors) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state := managedTrustAnchorsJSON{
+		LastRefresh: m.lastRefresh,
+		Keys:        make([]managedKeyJSON, 0, len(m.keys)),
+	}
+	for _, k := range m.keys {
+		state.Keys = append(state.Keys, managedKeyJSON{
+			DNSKEY:    k.DNSKEY.String(),
+			State:     k.State,
+			FirstSeen: k.FirstSeen,
+			LastSeen:  k.LastSeen,
+			Changed:   k.Changed,
+		})
+	}
+	buf, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Replace the state file atomically, so a crash cannot leave
+	// a truncated file behind.
+	tmp, err := os.CreateTemp(filepath.Dir(m.fileName), filepath.Base(m.fileName))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), m.fileName)
+}
+
+// Keys returns a copy of the tracked keys and their states.
+func (m *ManagedTrustAnchors) Keys() []ManagedKey {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]ManagedKey, 0, len(m.keys))
+	for _, k := range m.keys {
+		keys = append(keys, *k)
+	}
+	return keys
+}
+
+// TrustAnchors returns the DS records of the keys that are currently
+// trusted, i.e. keys in the Valid or Missing state.  Before the first
+// refresh these are the initial trust anchors.
+func (m *ManagedTrustAnchors) TrustAnchors() []*dns.DS {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.keys) < 1 {
+		return m.initial
+	}
+	anchors := make([]*dns.DS, 0, len(m.keys))
+	for _, k := range m.keys {
+		if k.isTrusted() {
+			anchors = append(anchors, k.DNSKEY.ToDS(dns.SHA256))
+		}
+	}
+	return anchors
+}
+
+// isTrusted returns true if the key can be used as a trust anchor.
+func (k *ManagedKey) isTrusted() bool {
+	return k.State == KeyStateValid || k.State == KeyStateMissing
+}
+
+// sameKey returns true if a and b hold the same key material, ignoring
+// the REVOKE flag.
+func sameKey(a *dns.DNSKEY, b *dns.DNSKEY) bool {
+	return a.Flags|dns.REVOKE == b.Flags|dns.REVOKE &&
+		a.Protocol == b.Protocol &&
+		a.Algorithm == b.Algorithm &&
+		strings.Replace(a.PublicKey, " ", "", -1) == strings.Replace(b.PublicKey, " ", "", -1)
+}
+
+// lookup returns the managed key holding the same key material as key.
+func (m *ManagedTrustAnchors) lookup(key *dns.DNSKEY) *ManagedKey {
+	for _, k := range m.keys {
+		if sameKey(k.DNSKEY, key) {
+			return k
+		}
+	}
+	return nil
+}
+
+// isTrustAnchor returns true if key matches a currently trusted key, or,
+// before the state is bootstrapped, one of the initial DS records.
+func (m *ManagedTrustAnchors) isTrustAnchor(key *dns.DNSKEY) bool {
+	if key.Flags&dns.REVOKE != 0 {
+		return false
+	}
+	if len(m.keys) < 1 {
+		return m.isInitialAnchor(key)
+	}
+	k := m.lookup(key)
+	return k != nil && k.isTrusted()
+}
+
+// isInitialAnchor returns true if key matches one of the initial DS
+// records.
+func (m *ManagedTrustAnchors) isInitialAnchor(key *dns.DNSKEY) bool {
+	if key.Flags&dns.REVOKE != 0 {
+		return false
+	}
+	for _, ds := range m.initial {
+		keyDs := key.ToDS(ds.DigestType)
+		if keyDs != nil && ds.KeyTag == keyDs.KeyTag && ds.Algorithm == keyDs.Algorithm &&
+			strings.EqualFold(ds.Digest, keyDs.Digest) {
+			return true
+		}
+	}
+	return false
+}
+
+// update runs the RFC 5011 state machine on the root DNSKEY RRset.
+// The RRset has to be signed by a currently trusted key, otherwise the
+// state is left untouched.
+func (m *ManagedTrustAnchors) update(keys []*dns.DNSKEY, sigs []*dns.RRSIG, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Signatures are checked against the resolver's clock, the state
+	// machine runs at now.
+	signedZone := NewSignedZone(".")
+	signedZone.now = resolver.now
+	signedZone.skew = resolver.skew
+	// A revoked key has to sign the RRset itself.
+	signedZone.revokedSelfSig = true
+	signedZone.pubKeyLookup = make(map[uint16][]*dns.DNSKEY)
+	for _, key := range keys {
+		signedZone.dnskey.rrSet = append(signedZone.dnskey.rrSet, key)
+		signedZone.addPubKey(key)
+	}
+
+	// selfSigned returns true if key has a valid signature on the RRset.
+	selfSigned := func(key *dns.DNSKEY) bool {
+		for _, sig := range sigs {
+			if sig.KeyTag != key.KeyTag() || sig.Algorithm != key.Algorithm {
+				continue
+			}
+			if signedZone.verifySignature(sig, signedZone.dnskey.rrSet) == nil {
+				return true
+			}
+		}
+		return false
+	}
+
+	validated := false
+	for _, key := range keys {
+		if m.isTrustAnchor(key) && selfSigned(key) {
+			validated = true
+			break
+		}
+	}
+	if !validated {
+		log.Printf("root DNSKEY RRset is not signed by a trust anchor\n")
+		return ErrTrustAnchorMismatch
+	}
+
+	bootstrap := len(m.keys) < 1
+	seen := make(map[*ManagedKey]bool)
+	for _, key := range keys {
+		if key.Flags&dns.SEP == 0 {
+			continue
+		}
+		k := m.lookup(key)
+
+		if key.Flags&dns.REVOKE != 0 {
+			// A revoked key has to sign the RRset itself; unknown
+			// revoked keys are ignored.
+			if k != nil && k.State != KeyStateRevoked && selfSigned(key) {
+				k.DNSKEY = key
+				k.State = KeyStateRevoked
+				k.Changed = now
+			}
+			if k != nil {
+				seen[k] = true
+				k.LastSeen = now
+			}
+			continue
+		}
+
+		switch {
+		case k == nil && bootstrap && m.isInitialAnchor(key):
+			k = &ManagedKey{DNSKEY: key, State: KeyStateValid, FirstSeen: now, Changed: now}
+			m.keys = append(m.keys, k)
+		case k == nil:
+			k = &ManagedKey{DNSKEY: key, State: KeyStateAddPend, FirstSeen: now, Changed: now}
+			m.keys = append(m.keys, k)
+		case k.State == KeyStateAddPend && now.Sub(k.FirstSeen) >= AddHoldDown:
+			k.State = KeyStateValid
+			k.Changed = now
+		case k.State == KeyStateMissing:
+			k.State = KeyStateValid
+			k.Changed = now
+		}
+		seen[k] = true
+		k.LastSeen = now
+	}
+
+	keep := make([]*ManagedKey, 0, len(m.keys))
+	for _, k := range m.keys {
+		if !seen[k] {
+			switch k.State {
+			case KeyStateAddPend:
+				// Back to Start
+				continue
+			case KeyStateValid:
+				k.State = KeyStateMissing
+				k.Changed = now
+			}
+		}
+		if k.State == KeyStateRevoked && now.Sub(k.Changed) >= RemoveHoldDown {
+			// Removed
+			continue
+		}
+		keep = append(keep, k)
+	}
+	m.keys = keep
+	m.lastRefresh = now
+	return nil
+}
+
+// SetManagedTrustAnchors makes the resolver use the keys tracked by m as
+// its root trust anchors.
+func (resolver *Resolver) SetManagedTrustAnchors(m *ManagedTrustAnchors) error {
+	err := resolver.SetRootTrustAnchors(m.TrustAnchors())
+	if err != nil {
+		return err
+	}
+	resolver.managedTrustAnchors = m
+	return nil
+}
+
+// RefreshTrustAnchors queries the root DNSKEY RRset, updates the state
+// of the managed trust anchors and saves it.  Long running applications
+// should call it periodically, e.g. every 12 hours.
+func (resolver *Resolver) RefreshTrustAnchors() error {
+	return resolver.refreshTrustAnchors(resolver.now())
+}
+
+func (resolver *Resolver) refreshTrustAnchors(now time.Time) error {
+	m := resolver.managedTrustAnchors
+	if m == nil {
+		return ErrInvalidTrustAnchor
+	}
+
+	r, err := resolver.queryFn(".", dns.TypeDNSKEY)
+	if err != nil {
+		return err
+	}
+	keys := make([]*dns.DNSKEY, 0, len(r.Answer))
+	sigs := make([]*dns.RRSIG, 0, len(r.Answer))
+	for _, rr := range r.Answer {
+		switch t := rr.(type) {
+		case *dns.DNSKEY:
+			keys = append(keys, t)
+		case *dns.RRSIG:
+			if t.TypeCovered == dns.TypeDNSKEY {
+				sigs = append(sigs, t)
+			}
+		}
+	}
+
+	if err := m.update(keys, sigs, now); err != nil {
+		return err
+	}
+	if err := m.Save(); err != nil {
+		return err
+	}
+	return resolver.SetRootTrustAnchors(m.TrustAnchors())
+}
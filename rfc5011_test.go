@@ -0,0 +1,215 @@
+package goresolver
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func newManagedTestResolver(t *testing.T, n *testNet) (*Resolver, *ManagedTrustAnchors, string) {
+	stateFile := path.Join(t.TempDir(), "managed-keys.json")
+	m, err := NewManagedTrustAnchors(stateFile, n.rootAnchors())
+	if err != nil {
+		t.Fatal("cannot initialize managed trust anchors", err)
+	}
+	resolver := n.newResolver()
+	if err := resolver.SetManagedTrustAnchors(m); err != nil {
+		t.Fatal("cannot set managed trust anchors", err)
+	}
+	return resolver, m, stateFile
+}
+
+func managedKeyState(m *ManagedTrustAnchors, key *dns.DNSKEY) KeyState {
+	for _, k := range m.Keys() {
+		if sameKey(k.DNSKEY, key) {
+			return k.State
+		}
+	}
+	return ""
+}
+
+func TestManagedTrustAnchorsBootstrap(t *testing.T) {
+	n := newSignedTestNet(t)
+	resolver, m, _ := newManagedTestResolver(t, n)
+
+	if err := resolver.RefreshTrustAnchors(); err != nil {
+		t.Fatal("shouldn't return err: ", err)
+	}
+	if managedKeyState(m, n.zones["."].ksk) != KeyStateValid {
+		t.Error("initial trust anchor should be Valid")
+	}
+	if len(m.Keys()) != 1 {
+		t.Error("only SEP keys should be tracked")
+	}
+	if _, err := resolver.LookupIPv4("www.example.org."); err != nil {
+		t.Error("should validate: ", err)
+	}
+}
+
+func TestManagedTrustAnchorsBootstrapTwoAnchors(t *testing.T) {
+	n := newSignedTestNet(t)
+	root := n.zones["."]
+	secondKsk, secondSigner := n.newKey(".", 257)
+	root.rrs = append(root.rrs, secondKsk)
+	root.extraKeys = append(root.extraKeys, testKey{secondKsk, secondSigner})
+
+	stateFile := path.Join(t.TempDir(), "managed-keys.json")
+	m, _ := NewManagedTrustAnchors(stateFile, append(n.rootAnchors(), secondKsk.ToDS(dns.SHA256)))
+	resolver := n.newResolver()
+	_ = resolver.SetManagedTrustAnchors(m)
+
+	if err := resolver.RefreshTrustAnchors(); err != nil {
+		t.Fatal("shouldn't return err: ", err)
+	}
+	if managedKeyState(m, root.ksk) != KeyStateValid || managedKeyState(m, secondKsk) != KeyStateValid {
+		t.Error("every initial trust anchor should be Valid")
+	}
+}
+
+func TestManagedTrustAnchorsConcurrentRefresh(t *testing.T) {
+	n := newSignedTestNet(t)
+	resolver, _, _ := newManagedTestResolver(t, n)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			_ = resolver.RefreshTrustAnchors()
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		if _, err := resolver.LookupIPv4("www.example.org."); err != nil {
+			t.Error("should validate during a refresh: ", err)
+		}
+	}
+	<-done
+}
+
+func TestManagedTrustAnchorsUntrustedRRset(t *testing.T) {
+	n := newSignedTestNet(t)
+	stateFile := path.Join(t.TempDir(), "managed-keys.json")
+	m, _ := NewManagedTrustAnchors(stateFile, DefaultRootTrustAnchors())
+	resolver := n.newResolver()
+	_ = resolver.SetManagedTrustAnchors(m)
+
+	if err := resolver.RefreshTrustAnchors(); err != ErrTrustAnchorMismatch {
+		t.Error("should return ErrTrustAnchorMismatch")
+	}
+	if len(m.Keys()) > 0 {
+		t.Error("state shouldn't change")
+	}
+}
+
+func TestManagedTrustAnchorsClock(t *testing.T) {
+	n := newSignedTestNet(t)
+	resolver, m, _ := newManagedTestResolver(t, n)
+	// The signatures of the root DNSKEY RRset have expired.
+	resolver.SetClock(func() time.Time { return time.Now().Add(365 * 24 * time.Hour) })
+
+	if err := resolver.RefreshTrustAnchors(); err == nil {
+		t.Error("expired DNSKEY RRset shouldn't update the trust anchors")
+	}
+	if len(m.Keys()) > 0 {
+		t.Error("state shouldn't change")
+	}
+}
+
+func TestManagedTrustAnchorsRollover(t *testing.T) {
+	n := newSignedTestNet(t)
+	root := n.zones["."]
+	resolver, m, stateFile := newManagedTestResolver(t, n)
+	now := time.Now()
+	oldKsk := root.ksk
+
+	if err := resolver.refreshTrustAnchors(now); err != nil {
+		t.Fatal("shouldn't return err: ", err)
+	}
+
+	// Publish a new KSK, signing the DNSKEY RRset with both keys.
+	newKsk, newSigner := n.newKey(".", 257)
+	root.rrs = append(root.rrs, newKsk)
+	root.extraKeys = append(root.extraKeys, testKey{newKsk, newSigner})
+
+	_ = resolver.refreshTrustAnchors(now.Add(24 * time.Hour))
+	if managedKeyState(m, newKsk) != KeyStateAddPend {
+		t.Error("new key should be AddPend")
+	}
+	_ = resolver.refreshTrustAnchors(now.Add(15 * 24 * time.Hour))
+	if managedKeyState(m, newKsk) != KeyStateAddPend {
+		t.Error("new key should stay AddPend during the hold-down time")
+	}
+
+	// The state survives a restart.
+	m, err := NewManagedTrustAnchors(stateFile, nil)
+	if err != nil {
+		t.Fatal("cannot load state: ", err)
+	}
+	if err := resolver.SetManagedTrustAnchors(m); err != nil {
+		t.Fatal("cannot set managed trust anchors", err)
+	}
+	if managedKeyState(m, newKsk) != KeyStateAddPend {
+		t.Error("new key should be AddPend after reload")
+	}
+
+	_ = resolver.refreshTrustAnchors(now.Add(32 * 24 * time.Hour))
+	if managedKeyState(m, newKsk) != KeyStateValid {
+		t.Error("new key should be Valid after the hold-down time")
+	}
+	if len(resolver.zoneTrustAnchors(".")) != 2 {
+		t.Error("both keys should be trust anchors")
+	}
+
+	// Revoke the old KSK, the new KSK takes over.
+	revoked := dns.Copy(oldKsk).(*dns.DNSKEY)
+	revoked.Flags |= dns.REVOKE
+	for i, rr := range root.rrs {
+		if rr == oldKsk {
+			root.rrs[i] = revoked
+		}
+	}
+	root.extraKeys = []testKey{{revoked, root.kskSigner}}
+	root.ksk, root.kskSigner = newKsk, newSigner
+
+	_ = resolver.refreshTrustAnchors(now.Add(40 * 24 * time.Hour))
+	if managedKeyState(m, oldKsk) != KeyStateRevoked {
+		t.Error("old key should be Revoked")
+	}
+	if len(resolver.zoneTrustAnchors(".")) != 1 || resolver.zoneTrustAnchors(".")[0].KeyTag != newKsk.KeyTag() {
+		t.Error("only the new key should be a trust anchor")
+	}
+	if _, err := resolver.LookupIPv4("www.example.org."); err != nil {
+		t.Error("should validate with the new key: ", err)
+	}
+
+	_ = resolver.refreshTrustAnchors(now.Add(71 * 24 * time.Hour))
+	if managedKeyState(m, oldKsk) != "" {
+		t.Error("revoked key should be removed after the hold-down time")
+	}
+}
+
+func TestManagedTrustAnchorsMissingKey(t *testing.T) {
+	n := newSignedTestNet(t)
+	root := n.zones["."]
+	resolver, m, _ := newManagedTestResolver(t, n)
+	now := time.Now()
+	_ = resolver.refreshTrustAnchors(now)
+
+	newKsk, newSigner := n.newKey(".", 257)
+	root.rrs = append(root.rrs, newKsk)
+	root.extraKeys = append(root.extraKeys, testKey{newKsk, newSigner})
+	_ = resolver.refreshTrustAnchors(now.Add(time.Hour))
+	_ = resolver.refreshTrustAnchors(now.Add(31 * 24 * time.Hour))
+
+	// Withdraw the new key without revoking it.
+	root.rrs = root.rrs[:len(root.rrs)-1]
+	root.extraKeys = nil
+	_ = resolver.refreshTrustAnchors(now.Add(32 * 24 * time.Hour))
+	if managedKeyState(m, newKsk) != KeyStateMissing {
+		t.Error("withdrawn key should be Missing")
+	}
+	if len(resolver.zoneTrustAnchors(".")) != 2 {
+		t.Error("missing keys should remain trust anchors")
+	}
+}
@@ -0,0 +1,142 @@
+package goresolver
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// KeyDigest is a trust anchor read from an IANA root-anchors.xml file,
+// along with the period it is valid for.  A zero ValidUntil means the
+// trust anchor does not expire.
+//
+// https://tools.ietf.org/html/rfc7958
+type KeyDigest struct {
+	ID         string
+	DS         *dns.DS
+	ValidFrom  time.Time
+	ValidUntil time.Time
+}
+
+type trustAnchorXML struct {
+	XMLName    xml.Name       `xml:"TrustAnchor"`
+	ID         string         `xml:"id,attr"`
+	Source     string         `xml:"source,attr"`
+	Zone       string         `xml:"Zone"`
+	KeyDigests []keyDigestXML `xml:"KeyDigest"`
+}
+
+type keyDigestXML struct {
+	ID         string `xml:"id,attr"`
+	ValidFrom  string `xml:"validFrom,attr"`
+	ValidUntil string `xml:"validUntil,attr"`
+	KeyTag     uint16 `xml:"KeyTag"`
+	Algorithm  uint8  `xml:"Algorithm"`
+	DigestType uint8  `xml:"DigestType"`
+	Digest     string `xml:"Digest"`
+}
+
+// IsValid returns true if the trust anchor is valid at time t.
+func (k *KeyDigest) IsValid(t time.Time) bool {
+	if t.Before(k.ValidFrom) {
+		return false
+	}
+	return k.ValidUntil.IsZero() || t.Before(k.ValidUntil)
+}
+
+// ParseTrustAnchorXML reads a trust anchor file in the format published
+// by IANA (RFC 7958) and returns every KeyDigest it contains,
+// regardless of its validity period.
+func ParseTrustAnchorXML(r io.Reader) ([]*KeyDigest, error) {
+	var doc trustAnchorXML
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	zone := strings.TrimSpace(doc.Zone)
+	if zone == "" {
+		return nil, ErrInvalidTrustAnchor
+	}
+
+	keyDigests := make([]*KeyDigest, 0, len(doc.KeyDigests))
+	for _, kd := range doc.KeyDigests {
+		validFrom, err := time.Parse(time.RFC3339, kd.ValidFrom)
+		if err != nil {
+			return nil, ErrInvalidTrustAnchor
+		}
+		var validUntil time.Time
+		if kd.ValidUntil != "" {
+			validUntil, err = time.Parse(time.RFC3339, kd.ValidUntil)
+			if err != nil {
+				return nil, ErrInvalidTrustAnchor
+			}
+		}
+		digest := strings.ToUpper(strings.TrimSpace(kd.Digest))
+		if digest == "" {
+			return nil, ErrInvalidTrustAnchor
+		}
+		keyDigests = append(keyDigests, &KeyDigest{
+			ID: kd.ID,
+			DS: &dns.DS{
+				Hdr: dns.RR_Header{
+					Name:   dns.Fqdn(zone),
+					Rrtype: dns.TypeDS,
+					Class:  dns.ClassINET,
+				},
+				KeyTag:     kd.KeyTag,
+				Algorithm:  kd.Algorithm,
+				DigestType: kd.DigestType,
+				Digest:     digest,
+			},
+			ValidFrom:  validFrom,
+			ValidUntil: validUntil,
+		})
+	}
+	return keyDigests, nil
+}
+
+// ActiveTrustAnchors returns the DS records of the key digests that are
+// valid at time t.
+func ActiveTrustAnchors(keyDigests []*KeyDigest, t time.Time) []*dns.DS {
+	anchors := make([]*dns.DS, 0, len(keyDigests))
+	for _, kd := range keyDigests {
+		if kd.IsValid(t) {
+			anchors = append(anchors, kd.DS)
+		}
+	}
+	return anchors
+}
+
+// LoadTrustAnchorFile reads an IANA root-anchors.xml file and returns
+// the trust anchors that are valid at time t.
+func LoadTrustAnchorFile(fileName string, t time.Time) ([]*dns.DS, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	keyDigests, err := ParseTrustAnchorXML(f)
+	if err != nil {
+		return nil, err
+	}
+	anchors := ActiveTrustAnchors(keyDigests, t)
+	if len(anchors) < 1 {
+		return nil, ErrInvalidTrustAnchor
+	}
+	return anchors, nil
+}
+
+// LoadRootTrustAnchors replaces the root trust anchors of the resolver
+// with the ones valid, according to the resolver's clock, in an IANA
+// root-anchors.xml file.
+func (resolver *Resolver) LoadRootTrustAnchors(fileName string) error {
+	anchors, err := LoadTrustAnchorFile(fileName, resolver.now())
+	if err != nil {
+		return err
+	}
+	return resolver.SetRootTrustAnchors(anchors)
+}
@@ -0,0 +1,97 @@
+package goresolver
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTrustAnchorXML(t *testing.T) {
+	f, err := os.Open("./testdata/root-anchors.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	keyDigests, err := ParseTrustAnchorXML(f)
+	if err != nil {
+		t.Fatal("shouldn't return err: ", err)
+	}
+	if len(keyDigests) != 3 {
+		t.Fatal("should return all KeyDigest entries")
+	}
+	kd := keyDigests[0]
+	if kd.ID != "Kjqmt7v" || kd.DS.KeyTag != 19036 || kd.DS.Hdr.Name != "." {
+		t.Error("KeyDigest not parsed correctly")
+	}
+	if kd.ValidUntil.IsZero() || !keyDigests[1].ValidUntil.IsZero() {
+		t.Error("validUntil not parsed correctly")
+	}
+}
+
+func TestActiveTrustAnchors(t *testing.T) {
+	tests := []struct {
+		at      time.Time
+		keyTags []uint16
+	}{
+		{time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), []uint16{19036}},
+		{time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC), []uint16{19036, 20326}},
+		{time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), []uint16{20326}},
+		{time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), []uint16{20326, 38696}},
+	}
+	for _, test := range tests {
+		anchors, err := LoadTrustAnchorFile("./testdata/root-anchors.xml", test.at)
+		if err != nil {
+			t.Fatal("shouldn't return err: ", err)
+		}
+		if len(anchors) != len(test.keyTags) {
+			t.Errorf("%s: expected %d trust anchors, got %d", test.at, len(test.keyTags), len(anchors))
+			continue
+		}
+		for i, ds := range anchors {
+			if ds.KeyTag != test.keyTags[i] {
+				t.Errorf("%s: unexpected trust anchor %d", test.at, ds.KeyTag)
+			}
+		}
+	}
+}
+
+func TestLoadTrustAnchorFileNoActiveAnchor(t *testing.T) {
+	_, err := LoadTrustAnchorFile("./testdata/root-anchors.xml", time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != ErrInvalidTrustAnchor {
+		t.Error("should return ErrInvalidTrustAnchor")
+	}
+}
+
+func TestParseTrustAnchorXMLInvalid(t *testing.T) {
+	doc := `<TrustAnchor><Zone>.</Zone><KeyDigest validFrom="yesterday"><KeyTag>1</KeyTag></KeyDigest></TrustAnchor>`
+	_, err := ParseTrustAnchorXML(strings.NewReader(doc))
+	if err != ErrInvalidTrustAnchor {
+		t.Error("should return ErrInvalidTrustAnchor")
+	}
+}
+
+func TestLoadRootTrustAnchors(t *testing.T) {
+	resolver, _ := NewResolver("./testdata/resolv.conf")
+	err := resolver.LoadRootTrustAnchors("./testdata/root-anchors.xml")
+	if err != nil {
+		t.Error("shouldn't return err: ", err)
+	}
+	if len(resolver.zoneTrustAnchors(".")) != 2 {
+		t.Error("should load the active trust anchors")
+	}
+}
+
+func TestLoadRootTrustAnchorsClock(t *testing.T) {
+	resolver, _ := NewResolver("./testdata/resolv.conf")
+	resolver.SetClock(func() time.Time { return time.Date(2012, 1, 1, 0, 0, 0, 0, time.UTC) })
+	err := resolver.LoadRootTrustAnchors("./testdata/root-anchors.xml")
+	if err != nil {
+		t.Error("shouldn't return err: ", err)
+	}
+	anchors := resolver.zoneTrustAnchors(".")
+	if len(anchors) != 1 || anchors[0].KeyTag != 19036 {
+		t.Error("should load the trust anchors active according to the resolver's clock")
+	}
+}
@@ -2,15 +2,32 @@ package goresolver
 
 import (
 	"log"
+	"strings"
 
 	"github.com/miekg/dns"
 )
 
 type RRSet struct {
 	rrSet []dns.RR
-	rrSig *dns.RRSIG
+	// rrSigs holds every RRSIG covering the RRset, as zones publish
+	// several signatures during key and algorithm rollovers.
+	rrSigs []*dns.RRSIG
+
+	// nameError is set if the query returned NXDOMAIN.
+	nameError bool
+	// denial holds the signed NSEC or NSEC3 RRsets of the Authority section,
+	// which prove the denial of existence of the queried RRs.
+	denial []*RRSet
+	// verifiedBy is the RRSIG which verified the RRset.
+	verifiedBy *dns.RRSIG
+	// cnames holds the CNAME RRsets leading from the queried name to the
+	// owner name of the RRset, each with its own RRSIGs.
+	cnames []*RRSet
 }
 
+// maxCNAMEs is the highest number of CNAME RRs followed in an answer.
+const maxCNAMEs = 8
+
 func (resolver *Resolver) queryRRset(qname string, qtype uint16) (*RRSet, error) {
 
 	r, err := resolver.queryFn(qname, qtype)
@@ -20,34 +37,101 @@ func (resolver *Resolver) queryRRset(qname string, qtype uint16) (*RRSet, error)
 		return nil, err
 	}
 
-	if r.Rcode == dns.RcodeNameError {
-		log.Printf("no such domain %s\n", qname)
-		return nil, ErrNoResult
+	result := NewSignedRRSet()
+	result.denial = denialRRsets(r.Ns)
+
+	// Only the qtype RRset of qname, or of the target of the CNAME RRsets
+	// starting at qname, is part of the answer, along with the CNAME
+	// RRsets.  Each RRset keeps the RRSIGs covering it.
+	rrSets, _ := groupRRsets(r.Answer)
+	name := canonicalName(qname)
+	for {
+		if rrSet, ok := rrSets[rrsetKey{name, dns.ClassINET, qtype}]; ok {
+			result.rrSet = rrSet.rrSet
+			result.rrSigs = rrSet.rrSigs
+			break
+		}
+		cname, ok := rrSets[rrsetKey{name, dns.ClassINET, dns.TypeCNAME}]
+		if !ok || len(result.cnames) == maxCNAMEs {
+			break
+		}
+		result.cnames = append(result.cnames, cname)
+		name = canonicalName(cname.rrSet[0].(*dns.CNAME).Target)
 	}
 
-	result := NewSignedRRSet()
+	if r.Rcode == dns.RcodeNameError {
+		log.Printf("no such domain %s\n", name)
+		result.nameError = true
+		return result, ErrNoResult
+	}
+	return result, nil
+}
 
-	if r.Answer == nil {
-		return result, nil
+// owner returns the name the RRset was found at: the target of the last
+// CNAME RRset leading to it, or qname.
+func (sRRset *RRSet) owner(qname string) string {
+	if len(sRRset.cnames) < 1 {
+		return qname
 	}
+	return sRRset.cnames[len(sRRset.cnames)-1].rrSet[0].(*dns.CNAME).Target
+}
 
-	result.rrSet = make([]dns.RR, 0, len(r.Answer))
+// rrsetKey identifies an RRset by owner name, class and type.
+type rrsetKey struct {
+	owner  string
+	class  uint16
+	rrType uint16
+}
 
-	for _, rr := range r.Answer {
-		switch t := rr.(type) {
-		case *dns.RRSIG:
-			result.rrSig = t
-		default:
-			if rr != nil {
-				result.rrSet = append(result.rrSet, rr)
-			}
+// groupRRsets groups rrs into RRsets by owner name, class and type, and
+// attaches to each RRset the RRSIGs whose owner name, class and type
+// covered match it.  RRSIGs that cover none of the RRsets are dropped.
+// It returns the RRsets along with their keys in the order they appear
+// in rrs.
+func groupRRsets(rrs []dns.RR) (map[rrsetKey]*RRSet, []rrsetKey) {
+	rrSets := make(map[rrsetKey]*RRSet)
+	keys := make([]rrsetKey, 0)
+	for _, rr := range rrs {
+		if rr == nil || rr.Header().Rrtype == dns.TypeRRSIG {
+			continue
 		}
+		key := rrsetKey{canonicalName(rr.Header().Name), rr.Header().Class, rr.Header().Rrtype}
+		rrSet, ok := rrSets[key]
+		if !ok {
+			rrSet = NewSignedRRSet()
+			rrSets[key] = rrSet
+			keys = append(keys, key)
+		}
+		rrSet.rrSet = append(rrSet.rrSet, rr)
 	}
-	return result, nil
+	for _, rr := range rrs {
+		sig, ok := rr.(*dns.RRSIG)
+		if !ok {
+			continue
+		}
+		key := rrsetKey{canonicalName(sig.Header().Name), sig.Header().Class, sig.TypeCovered}
+		if rrSet, ok := rrSets[key]; ok {
+			rrSet.rrSigs = append(rrSet.rrSigs, sig)
+		}
+	}
+	return rrSets, keys
+}
+
+// denialRRsets returns the NSEC and NSEC3 RRsets in rrs, along with the
+// RRSIGs covering each of them.
+func denialRRsets(rrs []dns.RR) []*RRSet {
+	denial := make([]*RRSet, 0)
+	rrSets, keys := groupRRsets(rrs)
+	for _, key := range keys {
+		if key.rrType == dns.TypeNSEC || key.rrType == dns.TypeNSEC3 {
+			denial = append(denial, rrSets[key])
+		}
+	}
+	return denial
 }
 
 func (sRRset *RRSet) IsSigned() bool {
-	return sRRset.rrSig != nil
+	return len(sRRset.rrSigs) > 0
 }
 
 func (sRRset *RRSet) IsEmpty() bool {
@@ -55,12 +139,42 @@ func (sRRset *RRSet) IsEmpty() bool {
 }
 
 func (sRRset *RRSet) SignerName() string {
-	return sRRset.rrSig.SignerName
+	return sRRset.rrSigs[0].SignerName
+}
+
+// wildcardExpansion returns true if the verified RRset was synthesized
+// from a wildcard, i.e. the labels field of the RRSIG which verified it
+// is lower than the number of labels of the owner name (RFC 4035 section
+// 5.3.4), along with the closest encloser, the parent of the wildcard.
+func (sRRset *RRSet) wildcardExpansion() (string, bool) {
+	rrSig := sRRset.verifiedBy
+	if rrSig == nil || sRRset.IsEmpty() {
+		return "", false
+	}
+	labels := dns.SplitDomainName(sRRset.rrSet[0].Header().Name)
+	if int(rrSig.Labels) >= ownerLabels(sRRset.rrSet[0].Header().Name) {
+		return "", false
+	}
+	return dns.Fqdn(strings.Join(labels[len(labels)-int(rrSig.Labels):], ".")), true
 }
 
+// ownerLabels returns the number of labels of name, not counting the
+// root and a leading wildcard label, as in the labels field of an RRSIG.
+func ownerLabels(name string) int {
+	labels := dns.CountLabel(name)
+	if strings.HasPrefix(name, "*.") {
+		labels--
+	}
+	return labels
+}
+
+// CheckHeaderIntegrity returns ErrForgedRRsig if an RRSIG of the RRset
+// isn't owned by qname.  Owner names are compared case-insensitively.
 func (sRRset *RRSet) CheckHeaderIntegrity(qname string) error {
-	if sRRset.rrSig != nil && sRRset.rrSig.Header().Name != qname {
-		return ErrForgedRRsig
+	for _, rrSig := range sRRset.rrSigs {
+		if canonicalName(rrSig.Header().Name) != canonicalName(qname) {
+			return ErrForgedRRsig
+		}
 	}
 	return nil
 }
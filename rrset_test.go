@@ -0,0 +1,124 @@
+package goresolver
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestGroupRRsets(t *testing.T) {
+	rrs := make([]dns.RR, 0)
+	for _, s := range []string{
+		"alias.example.org. 300 IN RRSIG CNAME 13 3 300 20300101000000 20000101000000 1 example.org. AAAA",
+		"alias.example.org. 300 IN CNAME www.example.org.",
+		"www.example.org. 300 IN A 192.0.2.1",
+		"WWW.example.org. 300 IN A 192.0.2.2",
+		"www.example.org. 300 IN RRSIG A 13 3 300 20300101000000 20000101000000 2 example.org. AAAA",
+		"www.example.org. 300 IN RRSIG TXT 13 3 300 20300101000000 20000101000000 3 example.org. AAAA",
+		"other.example.org. 300 IN RRSIG A 13 3 300 20300101000000 20000101000000 4 example.org. AAAA",
+	} {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal("cannot parse RR", err)
+		}
+		rrs = append(rrs, rr)
+	}
+
+	rrSets, keys := groupRRsets(rrs)
+	if len(keys) != 2 {
+		t.Fatal("should return the CNAME and A RRsets: ", keys)
+	}
+	cname := rrSets[rrsetKey{"alias.example.org.", dns.ClassINET, dns.TypeCNAME}]
+	if len(cname.rrSet) != 1 || len(cname.rrSigs) != 1 || cname.rrSigs[0].KeyTag != 1 {
+		t.Error("CNAME RRset should have its own RRSIG")
+	}
+	a := rrSets[rrsetKey{"www.example.org.", dns.ClassINET, dns.TypeA}]
+	if len(a.rrSet) != 2 || len(a.rrSigs) != 1 || a.rrSigs[0].KeyTag != 2 {
+		t.Error("A RRset should only have the RRSIG covering A at its owner")
+	}
+}
+
+func TestQueryRRsetCNAME(t *testing.T) {
+	n := newSignedTestNet(t)
+	example := n.zones["example.org."]
+	example.add(t, "alias.example.org. 300 IN CNAME www.example.org.")
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "alias.example.org." && qtype == dns.TypeA {
+			msg.Answer = append(example.lookup(t, qname, dns.TypeCNAME),
+				example.lookup(t, "www.example.org.", dns.TypeA)...)
+			msg.Ns = nil
+		}
+	}
+	resolver := n.newResolver()
+
+	result, err := resolver.StrictNSQuery("alias.example.org.", dns.TypeCNAME)
+	if err != nil || len(result.RRs) != 1 {
+		t.Error("CNAME should validate: ", err)
+	}
+	result, err = resolver.StrictNSQuery("alias.example.org.", dns.TypeA)
+	if err != nil || result.Status != Secure || len(result.RRs) != 1 ||
+		result.RRs[0].Header().Name != "www.example.org." {
+		t.Error("RRs of the CNAME target should validate: ", err)
+	}
+	result, err = resolver.LookupIPv4("alias.example.org.")
+	if err != nil || result.Status != Secure || len(result.IPs()) != 1 {
+		t.Error("IPs of the CNAME target should validate: ", err)
+	}
+}
+
+func TestQueryRRsetCNAMETargetCase(t *testing.T) {
+	n := newSignedTestNet(t)
+	example := n.zones["example.org."]
+	example.add(t, "alias.example.org. 300 IN CNAME WWW.Example.org.")
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "alias.example.org." && qtype == dns.TypeA {
+			msg.Answer = append(example.lookup(t, qname, dns.TypeCNAME),
+				example.lookup(t, "www.example.org.", dns.TypeA)...)
+			msg.Ns = nil
+		}
+	}
+	resolver := n.newResolver()
+
+	result, err := resolver.StrictNSQuery("alias.example.org.", dns.TypeA)
+	if err != nil || result.Status != Secure || len(result.RRs) != 1 {
+		t.Error("CNAME targets should match owner names case-insensitively: ", err)
+	}
+}
+
+func TestQueryRRsetCNAMEUnsigned(t *testing.T) {
+	n := newSignedTestNet(t)
+	example := n.zones["example.org."]
+	example.add(t, "alias.example.org. 300 IN CNAME www.example.org.")
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "alias.example.org." && qtype == dns.TypeA {
+			// The CNAME without its RRSIG.
+			msg.Answer = append(example.lookup(t, qname, dns.TypeCNAME)[:1],
+				example.lookup(t, "www.example.org.", dns.TypeA)...)
+			msg.Ns = nil
+		}
+	}
+	resolver := n.newResolver()
+
+	result, err := resolver.LookupIPType("alias.example.org.", dns.TypeA)
+	if err == nil || result.Status != Bogus || len(result.RRs) > 0 {
+		t.Error("CNAME without RRSIG shouldn't validate: ", err)
+	}
+}
+
+func TestQueryRRsetSignatureOfOtherOwner(t *testing.T) {
+	n := newSignedTestNet(t)
+	example := n.zones["example.org."]
+	example.add(t, "mail.example.org. 300 IN A 192.0.2.1")
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "mail.example.org." && qtype == dns.TypeA {
+			// The RRSIG of www, which has the same RDATA.
+			msg.Answer = append(msg.Answer[:1], example.lookup(t, "www.example.org.", dns.TypeA)[1])
+		}
+	}
+	resolver := n.newResolver()
+
+	_, err := resolver.LookupIPv4("mail.example.org.")
+	if err != ErrResourceNotSigned {
+		t.Error("RRSIG of another owner shouldn't sign the RRset: ", err)
+	}
+}
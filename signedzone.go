@@ -1,10 +1,12 @@
 package goresolver
 
 import (
-	"github.com/miekg/dns"
+	"errors"
 	"log"
 	"strings"
 	"time"
+
+	"github.com/miekg/dns"
 )
 
 // SignedZone represents a DNSSEC-enabled zone, its DNSKEY and DS records
@@ -13,80 +15,242 @@ type SignedZone struct {
 	dnskey       *RRSet
 	ds           *RRSet
 	parentZone   *SignedZone
-	pubKeyLookup map[uint16]*dns.DNSKEY
+	pubKeyLookup map[uint16][]*dns.DNSKEY
+	now          func() time.Time
+	skew         time.Duration
+	// revokedSelfSig allows a revoked key to verify its own signature on
+	// the DNSKEY RRset, which only the RFC 5011 update of the root trust
+	// anchors does.
+	revokedSelfSig bool
 }
 
-// lookupPubkey returns a DNSKEY by its keytag
-func (z SignedZone) lookupPubKey(keyTag uint16) *dns.DNSKEY {
-	return z.pubKeyLookup[keyTag]
+// lookupPubKey returns the DNSKEYs with the given keytag and algorithm.
+// Several keys of a zone may share a keytag.
+func (z SignedZone) lookupPubKey(keyTag uint16, algorithm uint8) []*dns.DNSKEY {
+	keys := make([]*dns.DNSKEY, 0, 1)
+	for _, k := range z.pubKeyLookup[keyTag] {
+		if k.Algorithm == algorithm {
+			keys = append(keys, k)
+		}
+	}
+	return keys
 }
 
-// addPubkey stores a DNSKEY in the keytag lookup table.
+// addPubKey stores a DNSKEY in the keytag lookup table.
 func (z SignedZone) addPubKey(k *dns.DNSKEY) {
-	z.pubKeyLookup[k.KeyTag()] = k
+	z.pubKeyLookup[k.KeyTag()] = append(z.pubKeyLookup[k.KeyTag()], k)
 }
 
-// verifyRRSIG verifies the signature on a signed
-// RRSET, and checks the validity period on the RRSIG.
-// It returns nil if the RRSIG verifies and the signature
-// is valid, and the appropriate error value in case
-// of validation failure.
+// verifyRRSIG verifies the signatures on a signed
+// RRSET, and checks the validity period on the RRSIGs.
+// It returns nil if any of the RRSIGs verifies with a
+// key of the zone and is valid, and the appropriate
+// error value in case of validation failure.
 func (z SignedZone) verifyRRSIG(signedRRset *RRSet) (err error) {
 
 	if !signedRRset.IsSigned() {
-		return ErrInvalidRRsig
+		return ErrResourceNotSigned
+	}
+
+	for _, rrSig := range signedRRset.rrSigs {
+		sigErr := z.verifySignature(rrSig, signedRRset.rrSet)
+		if sigErr == nil {
+			signedRRset.verifiedBy = rrSig
+			return nil
+		}
+		// Prefer the error of a signature made with a key of the zone.
+		if err == nil || err == ErrDnskeyNotAvailable {
+			err = sigErr
+		}
+	}
+	return err
+}
+
+// verifySignature verifies a single RRSIG on rrSet with each key
+// matching its keytag and algorithm, and checks its validity period.
+func (z SignedZone) verifySignature(rrSig *dns.RRSIG, rrSet []dns.RR) (err error) {
+
+	err = checkAlgorithmSupport(rrSig.Algorithm)
+	if err != nil {
+		log.Printf("RRSIG algorithm %d: %s\n", rrSig.Algorithm, err)
+		return err
+	}
+
+	// An RRSIG can't have more labels than its owner name (RFC 4035
+	// section 5.3.1).
+	if int(rrSig.Labels) > ownerLabels(rrSig.Hdr.Name) {
+		log.Printf("RRSIG labels %d exceed owner name %s\n", rrSig.Labels, rrSig.Hdr.Name)
+		return ErrInvalidRrsigLabels
+	}
+
+	err = z.checkSignerName(rrSig)
+	if err != nil {
+		return err
 	}
 
-	// Verify the RRSIG of the DNSKEY RRset
-	key := z.lookupPubKey(signedRRset.rrSig.KeyTag)
-	if key == nil {
-		log.Printf("DNSKEY keytag %d not found", signedRRset.rrSig.KeyTag)
+	keys := z.lookupPubKey(rrSig.KeyTag, rrSig.Algorithm)
+	if len(keys) < 1 {
+		log.Printf("DNSKEY keytag %d not found", rrSig.KeyTag)
 		return ErrDnskeyNotAvailable
 	}
 
-	err = signedRRset.rrSig.Verify(key, signedRRset.rrSet)
+	for _, key := range keys {
+		err = checkKeyUsable(key, z.revokedSelfSig && containsKey(rrSet, key))
+		if err != nil {
+			log.Printf("DNSKEY %d cannot verify RRSIG: %s\n", rrSig.KeyTag, err)
+			continue
+		}
+		err = z.checkSignature(rrSig, key, rrSet)
+		// A signature outside its validity period was made by key.
+		if err == nil || errors.Is(err, ErrRrsigValidityPeriod) {
+			return err
+		}
+	}
+	return err
+}
+
+// checkSignerName checks that the signer of the RRSIG is the zone, whose
+// keys are used to verify it, and that the zone contains the owner name
+// of the RRSIG (RFC 4035 section 5.3.1).
+func (z SignedZone) checkSignerName(rrSig *dns.RRSIG) error {
+	if canonicalName(rrSig.SignerName) != canonicalName(z.zone) || !dns.IsSubDomain(rrSig.SignerName, rrSig.Hdr.Name) {
+		log.Printf("RRSIG of %s signed by %s cannot be verified by %s\n", rrSig.Hdr.Name, rrSig.SignerName, z.zone)
+		return ErrInvalidSignerName
+	}
+	return nil
+}
+
+// checkKeyUsable checks that key may verify signatures (RFC 4034 section
+// 2.1.1 and RFC 5011 section 2.1): only zone keys are used, and a revoked
+// key only if selfSigned, to verify its own signature on the DNSKEY
+// RRset.
+func checkKeyUsable(key *dns.DNSKEY, selfSigned bool) error {
+	if key.Flags&dns.ZONE == 0 {
+		return ErrNoZoneKey
+	}
+	if key.Flags&dns.REVOKE != 0 && !selfSigned {
+		return ErrRevokedKey
+	}
+	return nil
+}
+
+// containsKey returns true if rrSet is a DNSKEY RRset containing key.
+func containsKey(rrSet []dns.RR, key *dns.DNSKEY) bool {
+	for _, rr := range rrSet {
+		if k, ok := rr.(*dns.DNSKEY); ok && k.Flags == key.Flags &&
+			k.Algorithm == key.Algorithm && k.PublicKey == key.PublicKey {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSignature verifies the RRSIG on rrSet with key, and checks its
+// validity period at the time of the zone's clock.  Errors outside of
+// the validity period are either ErrRrsigExpired or ErrRrsigNotYetValid.
+func (z SignedZone) checkSignature(rrSig *dns.RRSIG, key *dns.DNSKEY, rrSet []dns.RR) error {
+
+	err := rrSig.Verify(key, rrSet)
 	if err != nil {
 		log.Println("DNSKEY verification", err)
 		return err
 	}
 
-	if !signedRRset.rrSig.ValidityPeriod(time.Now()) {
+	err = validityPeriodError(rrSig, z.time(), z.skew)
+	if err != nil {
 		log.Println("invalid validity period", err)
-		return ErrRrsigValidityPeriod
 	}
-	return nil
+	return err
 }
 
-// verifyDS validates the DS record against the KSK
-// (key signing key) of the zone.
-// Return nil if the DS record matches the digest of
-// the KSK.
+// verifyDS validates the DS records against the KSKs
+// (key signing keys) of the zone.
+// Return nil if any DS record matches the digest of a
+// KSK which signs the DNSKEY RRset, and
+// ErrUnknownDsDigestType if no DS record has a
+// supported digest type.  Otherwise the error of the
+// closest match is returned: the signature error of a
+// matching KSK, ErrDsInvalid if a DNSKEY has the keytag
+// but not the digest of a DS record, or
+// ErrDnskeyNotAvailable, or ErrRevokedKey or ErrNoZoneKey if
+// the matching DNSKEY cannot be used.
 func (z SignedZone) verifyDS(dsRrset []dns.RR) (err error) {
 
-	for _, rr := range dsRrset {
+	dsSet := supportedDS(dsRrset)
+	if len(dsSet) < 1 {
+		return ErrUnknownDsDigestType
+	}
 
-		ds := rr.(*dns.DS)
+	err = ErrDnskeyNotAvailable
+	for _, ds := range dsSet {
 
-		if ds.DigestType != dns.SHA256 {
-			log.Printf("Unknown digest type (%d) on DS RR", ds.DigestType)
+		parentDsDigest := strings.ToUpper(ds.Digest)
+		keys := z.lookupPubKey(ds.KeyTag, ds.Algorithm)
+		if len(keys) < 1 {
+			log.Printf("DNSKEY keytag %d not found", ds.KeyTag)
 			continue
 		}
+		for _, key := range keys {
+			dsDigest := strings.ToUpper(key.ToDS(ds.DigestType).Digest)
+			if parentDsDigest != dsDigest {
+				log.Printf("DS does not match DNSKEY\n")
+				if err == ErrDnskeyNotAvailable {
+					err = ErrDsInvalid
+				}
+				continue
+			}
+			// Revoked keys are never trusted (RFC 5011 section 2.1).
+			if key.Flags&dns.REVOKE != 0 || key.Flags&dns.ZONE == 0 {
+				err = checkKeyUsable(key, false)
+				log.Printf("DS matches unusable DNSKEY %d: %s\n", ds.KeyTag, err)
+				continue
+			}
+			sigErr := z.verifySignedBy(key)
+			if sigErr == nil {
+				return nil
+			}
+			log.Printf("DNSKEY RRset is not signed by DNSKEY %d: %s\n", ds.KeyTag, sigErr)
+			err = sigErr
+		}
+	}
+	return err
+}
 
-		parentDsDigest := strings.ToUpper(ds.Digest)
-		key := z.lookupPubKey(ds.KeyTag)
-		if key == nil {
-			log.Printf("DNSKEY keytag %d not found", ds.KeyTag)
-			return ErrDnskeyNotAvailable
+// isDsMismatch returns true if verifyDS failed because no DS record
+// matches a DNSKEY of the zone, rather than because a matching DNSKEY
+// doesn't sign the DNSKEY RRset.
+func isDsMismatch(err error) bool {
+	return err == ErrDsInvalid || err == ErrDnskeyNotAvailable || err == ErrUnknownDsDigestType ||
+		err == ErrRevokedKey || err == ErrNoZoneKey
+}
+
+// verifySignedBy checks that key has a valid RRSIG on the DNSKEY RRset
+// of the zone.
+func (z SignedZone) verifySignedBy(key *dns.DNSKEY) error {
+	err := ErrResourceNotSigned
+	for _, rrSig := range z.dnskey.rrSigs {
+		if rrSig.KeyTag != key.KeyTag() || rrSig.Algorithm != key.Algorithm {
+			continue
 		}
-		dsDigest := strings.ToUpper(key.ToDS(ds.DigestType).Digest)
-		if parentDsDigest == dsDigest {
+		err = z.checkSignerName(rrSig)
+		if err != nil {
+			continue
+		}
+		err = z.checkSignature(rrSig, key, z.dnskey.rrSet)
+		if err == nil {
+			z.dnskey.verifiedBy = rrSig
 			return nil
 		}
+	}
+	return err
+}
 
-		log.Printf("DS does not match DNSKEY\n")
-		return ErrDsInvalid
+// time returns the current time of the zone's clock.
+func (z SignedZone) time() time.Time {
+	if z.now != nil {
+		return z.now()
 	}
-	return ErrUnknownDsDigestType
+	return time.Now()
 }
 
 // checkHasDnskeys returns true if the SignedZone has a DNSKEY
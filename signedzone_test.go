@@ -0,0 +1,282 @@
+package goresolver
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestMultipleRRSIGsUnknownKey(t *testing.T) {
+	n := newSignedTestNet(t)
+	example := n.zones["example.org."]
+	// A signature made with a key that isn't published in the zone.
+	key, signer := n.newKey("example.org.", 256)
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "www.example.org." && qtype == dns.TypeA {
+			sig := example.sign(t, msg.Answer[:1], key, signer)
+			msg.Answer = append([]dns.RR{sig}, msg.Answer...)
+		}
+	}
+	resolver := n.newResolver()
+
+	result, err := resolver.LookupIPv4("www.example.org.")
+	if err != nil {
+		t.Error("any valid RRSIG should validate: ", err)
+	}
+	if len(result.IPs()) != 1 {
+		t.Error("lookup should return results")
+	}
+}
+
+func TestMultipleRRSIGsAlgorithmRollover(t *testing.T) {
+	n := newSignedTestNet(t)
+	example := n.zones["example.org."]
+	key, signer := n.newKeyAlgorithm("example.org.", 256, dns.ECDSAP384SHA384)
+	example.rrs = append(example.rrs, key)
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "www.example.org." && qtype == dns.TypeA {
+			// Only the RRSIG of the new algorithm is valid.
+			newSig := example.sign(t, msg.Answer[:1], key, signer)
+			oldSig := dns.Copy(msg.Answer[1]).(*dns.RRSIG)
+			oldSig.Signature = newSig.Signature
+			msg.Answer = []dns.RR{msg.Answer[0], oldSig, newSig}
+		}
+	}
+	resolver := n.newResolver()
+
+	if _, err := resolver.LookupIPv4("www.example.org."); err != nil {
+		t.Error("the RRSIG of the new algorithm should validate: ", err)
+	}
+}
+
+func TestMultipleRRSIGsNoneValid(t *testing.T) {
+	n := newSignedTestNet(t)
+	example := n.zones["example.org."]
+	example.inception = time.Now().Add(-48 * time.Hour)
+	example.expiration = time.Now().Add(-24 * time.Hour)
+	key, signer := n.newKey("example.org.", 256)
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "www.example.org." && qtype == dns.TypeA {
+			msg.Answer = append(msg.Answer, example.sign(t, msg.Answer[:1], key, signer))
+		}
+	}
+	resolver := n.newResolver()
+
+	_, err := resolver.LookupIPv4("www.example.org.")
+	if !errors.Is(err, ErrInvalidRRsig) {
+		t.Error("should return ErrInvalidRRsig: ", err)
+	}
+	if !errors.Is(err, ErrRrsigExpired) {
+		t.Error("should report the error of the signature with a known key: ", err)
+	}
+}
+
+// collidingKey returns a different DNSKEY with the same keytag and
+// algorithm as key, by swapping two 16-bit words of its public key.
+func collidingKey(t *testing.T, key *dns.DNSKEY) *dns.DNSKEY {
+	pub, err := base64.StdEncoding.DecodeString(key.PublicKey)
+	if err != nil {
+		t.Fatal("cannot decode public key", err)
+	}
+	pub[0], pub[1], pub[2], pub[3] = pub[2], pub[3], pub[0], pub[1]
+	other := dns.Copy(key).(*dns.DNSKEY)
+	other.PublicKey = base64.StdEncoding.EncodeToString(pub)
+	if other.KeyTag() != key.KeyTag() || other.PublicKey == key.PublicKey {
+		t.Fatal("cannot create a colliding key")
+	}
+	return other
+}
+
+func TestKeyTagCollision(t *testing.T) {
+	n := newSignedTestNet(t)
+	example := n.zones["example.org."]
+	example.rrs = append(example.rrs, collidingKey(t, example.zsk), collidingKey(t, example.ksk))
+	resolver := n.newResolver()
+
+	result, err := resolver.LookupIPv4("www.example.org.")
+	if err != nil {
+		t.Error("keys sharing a keytag should all be tried: ", err)
+	}
+	if len(result.IPs()) != 1 {
+		t.Error("lookup should return results")
+	}
+}
+
+func TestDsRollover(t *testing.T) {
+	n := newSignedTestNet(t)
+	org := n.zones["org."]
+	example := n.zones["example.org."]
+	oldKsk, _ := n.newKey("example.org.", 257)
+	// The DS of the retired KSK comes first, with a different keytag and
+	// with a colliding one.
+	org.remove("example.org.", dns.TypeDS)
+	org.rrs = append(org.rrs, oldKsk.ToDS(dns.SHA256),
+		collidingKey(t, example.ksk).ToDS(dns.SHA256), example.ksk.ToDS(dns.SHA256))
+	resolver := n.newResolver()
+
+	if _, err := resolver.LookupIPv4("www.example.org."); err != nil {
+		t.Error("any matching DS should validate: ", err)
+	}
+}
+
+func TestDsPublishedKeyNotSigning(t *testing.T) {
+	n := newSignedTestNet(t)
+	example := n.zones["example.org."]
+	// A new KSK is published and has a DS, but doesn't sign yet.
+	newKsk, _ := n.newKey("example.org.", 257)
+	example.rrs = append(example.rrs, newKsk)
+	n.zones["org."].rrs = append(n.zones["org."].rrs, newKsk.ToDS(dns.SHA256))
+	resolver := n.newResolver()
+
+	if _, err := resolver.LookupIPv4("www.example.org."); err != nil {
+		t.Error("the DS of the signing KSK should validate: ", err)
+	}
+
+	n.setDS("example.org.")
+	n.zones["org."].rrs = append(n.zones["org."].rrs, newKsk.ToDS(dns.SHA256))
+	_, err := resolver.LookupIPv4("www.example.org.")
+	if !errors.Is(err, ErrRrsigValidationError) {
+		t.Error("a DS of a key not signing the DNSKEY RRset shouldn't validate: ", err)
+	}
+}
+
+// signDnskeyWithZsk makes the ZSK of zone sign its DNSKEY RRset instead
+// of the KSK.
+func signDnskeyWithZsk(t *testing.T, n *testNet, zone string) {
+	z := n.zones[zone]
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == zone && qtype == dns.TypeDNSKEY {
+			rrSet := msg.Answer[:len(msg.Answer)-1]
+			msg.Answer = append(rrSet, z.sign(t, rrSet, z.zsk, z.zskSigner))
+		}
+	}
+}
+
+func TestDnskeySignedByZsk(t *testing.T) {
+	n := newSignedTestNet(t)
+	signDnskeyWithZsk(t, n, "example.org.")
+	resolver := n.newResolver()
+
+	_, err := resolver.LookupIPv4("www.example.org.")
+	if !errors.Is(err, ErrRrsigValidationError) {
+		t.Error("DNSKEY RRset has to be signed by a key matching the DS: ", err)
+	}
+}
+
+func TestDnskeySignedByZskTrustAnchor(t *testing.T) {
+	n := newSignedTestNet(t)
+	signDnskeyWithZsk(t, n, ".")
+	resolver := n.newResolver()
+
+	_, err := resolver.LookupIPv4("www.example.org.")
+	if !errors.Is(err, ErrRrsigValidationError) {
+		t.Error("DNSKEY RRset has to be signed by a key matching the trust anchor: ", err)
+	}
+}
+
+// signAnswerWith publishes a key with the given flags in example.org. and
+// signs the answer for www.example.org. with it only.
+func signAnswerWith(t *testing.T, n *testNet, flags uint16) {
+	example := n.zones["example.org."]
+	key, signer := n.newKey("example.org.", flags)
+	example.rrs = append(example.rrs, key)
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "www.example.org." && qtype == dns.TypeA {
+			msg.Answer = append(msg.Answer[:1], example.sign(t, msg.Answer[:1], key, signer))
+		}
+	}
+}
+
+func TestSignatureOfNonZoneKey(t *testing.T) {
+	n := newSignedTestNet(t)
+	signAnswerWith(t, n, 0)
+	resolver := n.newResolver()
+
+	result, err := resolver.LookupIPv4("www.example.org.")
+	if !errors.Is(err, ErrNoZoneKey) {
+		t.Error("a key without the zone key bit shouldn't validate: ", err)
+	}
+	if result.ExtendedError == nil || result.ExtendedError.InfoCode != EDENoZoneKeyBitSet {
+		t.Error("should return No Zone Key Bit Set: ", result.ExtendedError)
+	}
+}
+
+func TestDnskeySignedByRevokedKey(t *testing.T) {
+	n := newSignedTestNet(t)
+	example := n.zones["example.org."]
+	key, signer := n.newKey("example.org.", 257|dns.REVOKE)
+	example.rrs = append(example.rrs, key)
+	answered := false
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		// The answer, unlike the DNSKEY RRset of the chain of trust, is
+		// only signed by the revoked key.
+		if qname == "example.org." && qtype == dns.TypeDNSKEY && !answered {
+			answered = true
+			rrSet := make([]dns.RR, 0)
+			for _, rr := range msg.Answer {
+				if rr.Header().Rrtype == dns.TypeDNSKEY {
+					rrSet = append(rrSet, rr)
+				}
+			}
+			msg.Answer = append(rrSet, example.sign(t, rrSet, key, signer))
+		}
+	}
+	resolver := n.newResolver()
+
+	result, err := resolver.StrictNSQuery("example.org.", dns.TypeDNSKEY)
+	if !errors.Is(err, ErrRevokedKey) || result.Status == Secure {
+		t.Error("a revoked key shouldn't validate the DNSKEY RRset: ", err)
+	}
+}
+
+func TestSignatureOfRevokedKey(t *testing.T) {
+	n := newSignedTestNet(t)
+	signAnswerWith(t, n, 256|dns.REVOKE)
+	resolver := n.newResolver()
+
+	_, err := resolver.LookupIPv4("www.example.org.")
+	if !errors.Is(err, ErrRevokedKey) {
+		t.Error("a revoked key should only sign the DNSKEY RRset: ", err)
+	}
+}
+
+func TestSignerNameOutsideZone(t *testing.T) {
+	n := newSignedTestNet(t)
+	example := n.zones["example.org."]
+	forged, _ := dns.NewRR("www.bank.org. 300 IN A 192.0.2.66")
+	rrSig := example.sign(t, []dns.RR{forged}, example.zsk, example.zskSigner)
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "www.bank.org." && qtype == dns.TypeA {
+			msg.Rcode = dns.RcodeSuccess
+			msg.Answer = []dns.RR{forged, rrSig}
+			msg.Ns = nil
+		}
+	}
+	resolver := n.newResolver()
+
+	result, err := resolver.StrictNSQuery("www.bank.org.", dns.TypeA)
+	if !errors.Is(err, ErrInvalidSignerName) || result.Status != Bogus {
+		t.Error("a zone shouldn't sign names outside of it: ", err)
+	}
+
+	authChain := NewAuthenticationChain()
+	if err := authChain.Populate("example.org."); err != nil {
+		t.Fatal("cannot populate the chain of trust: ", err)
+	}
+	signedZone := authChain.delegationChain[0]
+	answer := &RRSet{rrSet: []dns.RR{forged}, rrSigs: []*dns.RRSIG{rrSig}}
+	if err := signedZone.verifyRRSIG(answer); err != ErrInvalidSignerName {
+		t.Error("a zone shouldn't sign names outside of it: ", err)
+	}
+
+	www := example.lookup(t, "www.example.org.", dns.TypeA)
+	otherSigner := www[1].(*dns.RRSIG)
+	otherSigner.SignerName = "org."
+	answer = &RRSet{rrSet: www[:1], rrSigs: []*dns.RRSIG{otherSigner}}
+	if err := signedZone.verifyRRSIG(answer); err != ErrInvalidSignerName {
+		t.Error("the keys of a zone shouldn't verify RRSIGs of another signer: ", err)
+	}
+}
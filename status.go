@@ -0,0 +1,118 @@
+package goresolver
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ValidationStatus is the DNSSEC validation status of an answer, as
+// defined in RFC 4035 section 4.3.
+type ValidationStatus int
+
+const (
+	// Indeterminate means it could not be determined whether the answer
+	// should be signed, e.g. because there is no trust anchor for it.
+	Indeterminate ValidationStatus = iota
+	// Secure means the answer validated along a chain of trust from a
+	// trust anchor.
+	Secure
+	// Insecure means the answer belongs to a zone that is proven not to
+	// be signed, or that is below a negative trust anchor.
+	Insecure
+	// Bogus means the answer should be signed, but it didn't validate.
+	Bogus
+)
+
+func (s ValidationStatus) String() string {
+	switch s {
+	case Secure:
+		return "secure"
+	case Insecure:
+		return "insecure"
+	case Bogus:
+		return "bogus"
+	}
+	return "indeterminate"
+}
+
+// validationStatus returns the status of an answer whose validation
+// returned err.
+func validationStatus(err error) ValidationStatus {
+	switch {
+	case err == nil, errors.Is(err, ErrNxDomain), errors.Is(err, ErrNoData):
+		return Secure
+	case errors.Is(err, ErrInsecureDelegation):
+		return Insecure
+	case errors.Is(err, ErrNoTrustAnchor), errors.Is(err, ErrNoResult),
+		errors.Is(err, ErrNsNotAvailable), errors.Is(err, ErrInvalidQuery):
+		return Indeterminate
+	}
+	return Bogus
+}
+
+// Result holds the RRs returned by a lookup and their validation status.
+// RRs is empty unless the status is Secure or Insecure, except for the
+// unsigned answers returned by LookupIPType.  ExtendedError describes
+// why a Bogus or Indeterminate answer failed validation, and is nil
+// otherwise.  The TTLs of Secure RRs are capped by their signatures
+// (RFC 4035 section 5.3.3), and Validity is how long they may be
+// cached: the lowest of these TTLs and of the TTLs of the DNSKEY and DS
+// RRsets of the chain of trust.  Validity is zero unless the status is
+// Secure.  Wildcard is set if Secure RRs were synthesized from a
+// wildcard.
+type Result struct {
+	RRs           []dns.RR
+	Status        ValidationStatus
+	ExtendedError *ExtendedError
+	Validity      time.Duration
+	Wildcard      bool
+}
+
+// addCNAMEs combines the result for the target of the CNAME RRsets of
+// answer with their validation status and validity, and returns the
+// error of the lookup: a target reached through insecure CNAME RRsets
+// is insecure, and so is its denial of existence, and the CNAME RRsets
+// limit the validity of the result.
+func (result *Result) addCNAMEs(answer *RRSet, status ValidationStatus, validity time.Duration, err error) error {
+	if len(answer.cnames) < 1 || result.Status != Secure {
+		return err
+	}
+	if status == Insecure {
+		result.Status, result.Validity = Insecure, 0
+		if err != nil {
+			err = ErrNoResult
+		}
+		return err
+	}
+	if len(result.RRs) > 0 && validity < result.Validity {
+		result.Validity = validity
+	}
+	return err
+}
+
+// lookupError returns the error of a lookup with the given validation
+// status.  Insecure answers are returned with a nil error, their status
+// tells that they are not validated.
+func lookupError(status ValidationStatus, err error) error {
+	if status == Insecure && errors.Is(err, ErrInsecureDelegation) {
+		return nil
+	}
+	return err
+}
+
+// IPs returns the addresses of the A and AAAA RRs of the result.
+func (result *Result) IPs() []net.IP {
+	ips := make([]net.IP, 0, len(result.RRs))
+	for _, rr := range result.RRs {
+		switch t := rr.(type) {
+		case *dns.A:
+			ips = append(ips, t.A)
+		case *dns.AAAA:
+			ips = append(ips, t.AAAA)
+		}
+	}
+	return ips
+}
@@ -0,0 +1,97 @@
+package goresolver
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestValidationStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		status ValidationStatus
+	}{
+		{nil, Secure},
+		{ErrNxDomain, Secure},
+		{ErrNoData, Secure},
+		{ErrInsecureDelegation, Insecure},
+		{ErrNoTrustAnchor, Indeterminate},
+		{ErrNoResult, Indeterminate},
+		{ErrInvalidRRsig, Bogus},
+		{ErrDsNotAvailable, Bogus},
+		{ErrResourceNotSigned, Bogus},
+		{errors.New("unexpected"), Bogus},
+	}
+	for _, test := range tests {
+		if status := validationStatus(test.err); status != test.status {
+			t.Errorf("%v: got %s, want %s", test.err, status, test.status)
+		}
+	}
+}
+
+func TestStatusSecure(t *testing.T) {
+	resolver := newSignedTestNet(t).newResolver()
+
+	result, _ := resolver.LookupIPv4("www.example.org.")
+	if result.Status != Secure {
+		t.Error("should be secure: ", result.Status)
+	}
+	result, _ = resolver.LookupIP("www.example.org.")
+	if result.Status != Secure {
+		t.Error("should be secure: ", result.Status)
+	}
+	result, _ = resolver.StrictNSQuery("nonexistent.example.org.", dns.TypeA)
+	if result.Status != Secure {
+		t.Error("proven NXDOMAIN should be secure: ", result.Status)
+	}
+}
+
+func TestStatusInsecure(t *testing.T) {
+	resolver := newInsecureTestNet(t).newResolver()
+
+	result, _ := resolver.LookupIPv4("www.unsigned.org.")
+	if result.Status != Insecure {
+		t.Error("should be insecure: ", result.Status)
+	}
+	result, _ = resolver.StrictNSQuery("www.unsigned.org.", dns.TypeA)
+	if result.Status != Insecure {
+		t.Error("should be insecure: ", result.Status)
+	}
+
+	resolver = newBrokenTestNet(t).newResolver()
+	resolver.AddNegativeTrustAnchor("example.org.", time.Now().Add(time.Hour))
+	result, _ = resolver.LookupIP("www.example.org.")
+	if result.Status != Insecure {
+		t.Error("names under a negative trust anchor should be insecure: ", result.Status)
+	}
+}
+
+func TestStatusBogus(t *testing.T) {
+	resolver := newBrokenTestNet(t).newResolver()
+
+	result, _ := resolver.LookupIPv4("www.example.org.")
+	if result.Status != Bogus {
+		t.Error("expired signatures should be bogus: ", result.Status)
+	}
+	result, _ = resolver.StrictNSQuery("www.other.org.", dns.TypeA)
+	if result.Status != Bogus {
+		t.Error("mismatching DS should be bogus: ", result.Status)
+	}
+	if len(result.RRs) > 0 {
+		t.Error("bogus results shouldn't be returned")
+	}
+}
+
+func TestStatusIndeterminate(t *testing.T) {
+	resolver := newIslandTestNet(t).newResolver()
+
+	result, err := resolver.LookupIPv4("intranet.corp.internal.")
+	if !errors.Is(err, ErrNoTrustAnchor) {
+		t.Error("should return ErrNoTrustAnchor: ", err)
+	}
+	if result.Status != Indeterminate {
+		t.Error("should be indeterminate: ", result.Status)
+	}
+}
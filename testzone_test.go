@@ -0,0 +1,484 @@
+package goresolver
+
+import (
+	"crypto"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// testZone is an in-memory DNSSEC signed zone.  It is used to exercise
+// the validator against freshly signed data instead of the recorded
+// fixtures under testdata/.
+type testZone struct {
+	name       string
+	ksk        *dns.DNSKEY
+	zsk        *dns.DNSKEY
+	kskSigner  crypto.Signer
+	zskSigner  crypto.Signer
+	rrs        []dns.RR
+	extraKeys  []testKey
+	inception  time.Time
+	expiration time.Time
+
+	// nsec3, if set, makes the zone deny existence with NSEC3 records
+	// using its parameters instead of NSEC.  If its Flags have the
+	// Opt-Out bit set, insecure delegations get no NSEC3 RR.
+	nsec3 *dns.NSEC3PARAM
+	// unsigned zones have no DNSKEY, RRSIG and NSEC RRs.
+	unsigned bool
+}
+
+// testKey is an additional key signing the DNSKEY RRset of a testZone.
+type testKey struct {
+	key    *dns.DNSKEY
+	signer crypto.Signer
+}
+
+// testNet is a set of test zones answering the queries of a Resolver.
+// tamper, if set, can modify every response before it is returned.
+type testNet struct {
+	t      *testing.T
+	zones  map[string]*testZone
+	tamper func(qname string, qtype uint16, msg *dns.Msg)
+}
+
+// newTestNet creates a signed zone for each of zoneNames, parents first,
+// and publishes the DS record of each zone in its parent.
+func newTestNet(t *testing.T, zoneNames ...string) *testNet {
+	n := &testNet{t: t, zones: make(map[string]*testZone)}
+	for _, name := range zoneNames {
+		n.addZone(name)
+	}
+	return n
+}
+
+func (n *testNet) newKey(name string, flags uint16) (*dns.DNSKEY, crypto.Signer) {
+	return n.newKeyAlgorithm(name, flags, dns.ECDSAP256SHA256)
+}
+
+func (n *testNet) newKeyAlgorithm(name string, flags uint16, algorithm uint8) (*dns.DNSKEY, crypto.Signer) {
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     flags,
+		Protocol:  3,
+		Algorithm: algorithm,
+	}
+	bits := 256
+	switch algorithm {
+	case dns.ECDSAP384SHA384:
+		bits = 384
+	case dns.RSASHA1, dns.RSASHA1NSEC3SHA1, dns.RSASHA256, dns.RSASHA512:
+		bits = 2048
+	}
+	priv, err := key.Generate(bits)
+	if err != nil {
+		n.t.Fatal("cannot generate key", err)
+	}
+	return key, priv.(crypto.Signer)
+}
+
+func (n *testNet) addZone(name string) *testZone {
+	name = dns.Fqdn(name)
+	z := &testZone{
+		name:       name,
+		inception:  time.Now().Add(-time.Hour),
+		expiration: time.Now().Add(24 * time.Hour),
+	}
+	z.ksk, z.kskSigner = n.newKey(name, 257)
+	z.zsk, z.zskSigner = n.newKey(name, 256)
+	z.rrs = append(z.rrs, z.ksk, z.zsk)
+	nsName := "ns." + name
+	if name == "." {
+		nsName = "ns."
+	}
+	z.add(n.t, name+" 3600 IN SOA "+nsName+" hostmaster."+nsName+" 1 7200 3600 1209600 300")
+	if parent := n.parentZone(name); parent != nil {
+		parent.add(n.t, name+" 3600 IN NS "+nsName)
+		parent.rrs = append(parent.rrs, z.ksk.ToDS(dns.SHA256))
+	}
+	n.zones[name] = z
+	return z
+}
+
+// addUnsignedZone adds a zone without DNSSEC, delegated from its parent
+// without DS RRs.
+func (n *testNet) addUnsignedZone(name string) *testZone {
+	z := n.addZone(name)
+	z.unsigned = true
+	z.remove(z.name, dns.TypeDNSKEY)
+	if parent := n.parentZone(z.name); parent != nil {
+		parent.remove(z.name, dns.TypeDS)
+	}
+	return z
+}
+
+// setDS replaces the DS RRs of zone in its parent with the digests of
+// its KSK of the given types.
+func (n *testNet) setDS(zone string, digestTypes ...uint8) {
+	parent := n.parentZone(zone)
+	parent.remove(zone, dns.TypeDS)
+	for _, digestType := range digestTypes {
+		parent.rrs = append(parent.rrs, n.zones[zone].ksk.ToDS(digestType))
+	}
+}
+
+// rekey replaces the keys of zone with keys of algorithm, and updates
+// its DS RR in the parent.
+func (n *testNet) rekey(zone string, algorithm uint8) {
+	z := n.zones[zone]
+	z.remove(zone, dns.TypeDNSKEY)
+	z.ksk, z.kskSigner = n.newKeyAlgorithm(zone, 257, algorithm)
+	z.zsk, z.zskSigner = n.newKeyAlgorithm(zone, 256, algorithm)
+	z.rrs = append([]dns.RR{z.ksk, z.zsk}, z.rrs...)
+	if n.parentZone(zone) != nil {
+		n.setDS(zone, dns.SHA256)
+	}
+}
+
+// parentZone returns the closest zone above name, or nil.
+func (n *testNet) parentZone(name string) *testZone {
+	for name != "." {
+		labels := dns.SplitDomainName(name)
+		name = dns.Fqdn(strings.Join(labels[1:], "."))
+		if z, ok := n.zones[name]; ok {
+			return z
+		}
+	}
+	return nil
+}
+
+// zoneFor returns the zone that is authoritative for qname and qtype.
+func (n *testNet) zoneFor(qname string, qtype uint16) *testZone {
+	if z, ok := n.zones[qname]; ok && !(qtype == dns.TypeDS && qname != ".") {
+		return z
+	}
+	return n.parentZone(qname)
+}
+
+// add parses rr and adds it to the zone.
+func (z *testZone) add(t *testing.T, s string) {
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatal("cannot parse RR", err)
+	}
+	z.rrs = append(z.rrs, rr)
+}
+
+// remove deletes the RRs of the given owner name and type from the zone.
+func (z *testZone) remove(name string, rrType uint16) {
+	rrs := z.rrs[:0]
+	for _, rr := range z.rrs {
+		if !strings.EqualFold(rr.Header().Name, name) || rr.Header().Rrtype != rrType {
+			rrs = append(rrs, rr)
+		}
+	}
+	z.rrs = rrs
+}
+
+// sign returns the RRSIG on rrSet made with signer.
+func (z *testZone) sign(t *testing.T, rrSet []dns.RR, key *dns.DNSKEY, signer crypto.Signer) *dns.RRSIG {
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Ttl: rrSet[0].Header().Ttl},
+		KeyTag:     key.KeyTag(),
+		SignerName: z.name,
+		Algorithm:  key.Algorithm,
+		Inception:  uint32(z.inception.Unix()),
+		Expiration: uint32(z.expiration.Unix()),
+	}
+	if err := sig.Sign(signer, rrSet); err != nil {
+		t.Fatal("cannot sign RRset", err)
+	}
+	return sig
+}
+
+// lookup returns the RRs of the given owner name and type, followed by
+// their RRSIG.
+func (z *testZone) lookup(t *testing.T, qname string, qtype uint16) []dns.RR {
+	rrSet := make([]dns.RR, 0)
+	for _, rr := range z.rrs {
+		if strings.EqualFold(rr.Header().Name, qname) && rr.Header().Rrtype == qtype {
+			rrSet = append(rrSet, rr)
+		}
+	}
+	if len(rrSet) < 1 || z.unsigned {
+		return rrSet
+	}
+	if qtype == dns.TypeDNSKEY {
+		answer := append(rrSet, z.sign(t, rrSet, z.ksk, z.kskSigner))
+		for _, k := range z.extraKeys {
+			answer = append(answer, z.sign(t, rrSet, k.key, k.signer))
+		}
+		return answer
+	}
+	return append(rrSet, z.sign(t, rrSet, z.zsk, z.zskSigner))
+}
+
+// names returns the owner names of the zone in canonical order.
+func (z *testZone) names() []string {
+	seen := make(map[string]bool)
+	names := make([]string, 0, len(z.rrs))
+	for _, rr := range z.rrs {
+		name := canonicalName(rr.Header().Name)
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return canonicalCompare(names[i], names[j]) < 0
+	})
+	return names
+}
+
+// exists returns true if the zone has RRs owned by name, or by a name
+// below it if name is an empty non-terminal.
+func (z *testZone) exists(name string) bool {
+	for _, owner := range z.names() {
+		if dns.IsSubDomain(name, owner) {
+			return true
+		}
+	}
+	return false
+}
+
+// nsec returns the NSEC RR owned by the i-th name of the zone.
+func (z *testZone) nsec(i int) *dns.NSEC {
+	names := z.names()
+	types := []uint16{dns.TypeRRSIG, dns.TypeNSEC}
+	for _, rr := range z.rrs {
+		if canonicalName(rr.Header().Name) == names[i] && !hasType(types, rr.Header().Rrtype) {
+			types = append(types, rr.Header().Rrtype)
+		}
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return &dns.NSEC{
+		Hdr:        dns.RR_Header{Name: names[i], Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 300},
+		NextDomain: names[(i+1)%len(names)],
+		TypeBitMap: types,
+	}
+}
+
+// coveringNSEC returns the NSEC RR whose owner name is name, or which
+// covers name if it does not exist.
+func (z *testZone) coveringNSEC(name string) *dns.NSEC {
+	names := z.names()
+	i := len(names) - 1
+	for j, owner := range names {
+		if canonicalCompare(owner, name) > 0 {
+			break
+		}
+		i = j
+	}
+	return z.nsec(i)
+}
+
+// nsec3Names returns the names of the zone that have an NSEC3 RR, i.e.
+// the owner names and the empty non-terminals, in hash order.
+func (z *testZone) nsec3Names() []string {
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+	for _, name := range z.names() {
+		if z.nsec3.Flags&nsec3OptOut != 0 && z.isInsecureDelegation(name) {
+			continue
+		}
+		for dns.IsSubDomain(z.name, name) && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+			if name == "." {
+				break
+			}
+			labels := dns.SplitDomainName(name)
+			name = dns.Fqdn(strings.Join(labels[1:], "."))
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return z.hash(names[i]) < z.hash(names[j])
+	})
+	return names
+}
+
+// isInsecureDelegation returns true if name has NS RRs but no DS RRs in
+// the zone.
+func (z *testZone) isInsecureDelegation(name string) bool {
+	if canonicalCompare(name, z.name) == 0 {
+		return false
+	}
+	hasNS, hasDS := false, false
+	for _, rr := range z.rrs {
+		if canonicalCompare(rr.Header().Name, name) == 0 {
+			hasNS = hasNS || rr.Header().Rrtype == dns.TypeNS
+			hasDS = hasDS || rr.Header().Rrtype == dns.TypeDS
+		}
+	}
+	return hasNS && !hasDS
+}
+
+// hash returns the NSEC3 hash of name.
+func (z *testZone) hash(name string) string {
+	return dns.HashName(name, z.nsec3.Hash, z.nsec3.Iterations, z.nsec3.Salt)
+}
+
+// nsec3RR returns the NSEC3 RR of the i-th name in hash order.
+func (z *testZone) nsec3RR(i int) *dns.NSEC3 {
+	names := z.nsec3Names()
+	types := make([]uint16, 0)
+	for _, rr := range z.rrs {
+		if canonicalName(rr.Header().Name) == names[i] && !hasType(types, rr.Header().Rrtype) {
+			types = append(types, rr.Header().Rrtype)
+		}
+	}
+	if len(types) > 0 {
+		types = append(types, dns.TypeRRSIG)
+	}
+	if names[i] == z.name {
+		types = append(types, dns.TypeNSEC3PARAM)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	owner := z.hash(names[i]) + "." + z.name
+	if z.name == "." {
+		owner = z.hash(names[i]) + "."
+	}
+	next := z.hash(names[(i+1)%len(names)])
+	return &dns.NSEC3{
+		Hdr:        dns.RR_Header{Name: owner, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 300},
+		Hash:       z.nsec3.Hash,
+		Flags:      z.nsec3.Flags & nsec3OptOut,
+		Iterations: z.nsec3.Iterations,
+		SaltLength: uint8(len(z.nsec3.Salt) / 2),
+		Salt:       z.nsec3.Salt,
+		HashLength: 20,
+		NextDomain: next,
+		TypeBitMap: types,
+	}
+}
+
+// coveringNSEC3 returns the NSEC3 RR matching name, or covering its hash
+// if it does not exist.
+func (z *testZone) coveringNSEC3(name string) *dns.NSEC3 {
+	names := z.nsec3Names()
+	hash := z.hash(name)
+	i := len(names) - 1
+	for j, n := range names {
+		if z.hash(n) > hash {
+			break
+		}
+		i = j
+	}
+	return z.nsec3RR(i)
+}
+
+// denial returns the signed SOA and the signed NSEC (or NSEC3) RRs
+// matching or covering names, to be put in the Authority section.
+func (z *testZone) denial(t *testing.T, names ...string) []dns.RR {
+	rrs := z.lookup(t, z.name, dns.TypeSOA)
+	if z.unsigned {
+		return rrs
+	}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		var rr dns.RR = z.coveringNSEC(name)
+		if z.nsec3 != nil {
+			rr = z.coveringNSEC3(name)
+		}
+		if seen[rr.Header().Name] {
+			continue
+		}
+		seen[rr.Header().Name] = true
+		rrs = append(rrs, rr, z.sign(t, []dns.RR{rr}, z.zsk, z.zskSigner))
+	}
+	return rrs
+}
+
+// noDataDenial returns the denial of existence of the RRs of another
+// type at qname.  Names without an NSEC3 RR are denied by the closest
+// encloser proof.
+func (z *testZone) noDataDenial(t *testing.T, qname string) []dns.RR {
+	if z.nsec3 == nil {
+		return z.denial(t, qname)
+	}
+	closestEncloser := qname
+	for !hasName(z.nsec3Names(), closestEncloser) && closestEncloser != z.name {
+		labels := dns.SplitDomainName(closestEncloser)
+		closestEncloser = dns.Fqdn(strings.Join(labels[1:], "."))
+	}
+	return z.denial(t, closestEncloser, qname)
+}
+
+func hasName(names []string, name string) bool {
+	for _, n := range names {
+		if canonicalCompare(n, name) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// nameErrorDenial returns the denial of existence of qname.
+func (z *testZone) nameErrorDenial(t *testing.T, qname string) []dns.RR {
+	closestEncloser := z.closestEncloser(qname)
+	wildcard := "*." + strings.TrimPrefix(closestEncloser, ".")
+	if z.nsec3 == nil {
+		return z.denial(t, qname, wildcard)
+	}
+	labels := dns.SplitDomainName(qname)
+	nextCloser := dns.Fqdn(strings.Join(labels[len(labels)-dns.CountLabel(closestEncloser)-1:], "."))
+	return z.denial(t, closestEncloser, nextCloser, wildcard)
+}
+
+// closestEncloser returns the longest existing ancestor of name.
+func (z *testZone) closestEncloser(name string) string {
+	for !z.exists(name) && canonicalCompare(name, z.name) != 0 {
+		labels := dns.SplitDomainName(name)
+		name = dns.Fqdn(strings.Join(labels[1:], "."))
+	}
+	return name
+}
+
+func (n *testNet) query(qname string, qtype uint16) (*dns.Msg, error) {
+	msg := &dns.Msg{}
+	msg.SetQuestion(qname, qtype)
+	msg.Response = true
+	z := n.zoneFor(qname, qtype)
+	if z == nil {
+		msg.Rcode = dns.RcodeServerFailure
+		return msg, nil
+	}
+	msg.Answer = z.lookup(n.t, qname, qtype)
+	if len(msg.Answer) < 1 && !z.exists(qname) {
+		msg.Rcode = dns.RcodeNameError
+		msg.Ns = z.nameErrorDenial(n.t, qname)
+	} else if len(msg.Answer) < 1 {
+		msg.Ns = z.noDataDenial(n.t, qname)
+	}
+	if n.tamper != nil {
+		n.tamper(qname, qtype, msg)
+	}
+	return msg, nil
+}
+
+// rootAnchors returns the DS records of the test root zone.
+func (n *testNet) rootAnchors() []*dns.DS {
+	return []*dns.DS{n.zones["."].ksk.ToDS(dns.SHA256)}
+}
+
+// newResolver returns a Resolver that queries the test zones and trusts
+// the test root zone, if there is one.
+func (n *testNet) newResolver() *Resolver {
+	resolver, err := NewResolver("./testdata/resolv.conf")
+	if err != nil {
+		n.t.Fatal("cannot initialize resolver", err)
+	}
+	resolver.queryFn = n.query
+	if _, ok := n.zones["."]; !ok {
+		resolver.RemoveTrustAnchors(".")
+		return resolver
+	}
+	if err := resolver.SetRootTrustAnchors(n.rootAnchors()); err != nil {
+		n.t.Fatal("cannot set trust anchors", err)
+	}
+	return resolver
+}
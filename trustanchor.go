@@ -0,0 +1,287 @@
+package goresolver
+
+import (
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// rootTrustAnchors are the DS records of the IANA root zone KSKs
+// (KSK-2017 and KSK-2024), as published in
+// https://data.iana.org/root-anchors/root-anchors.xml
+var rootTrustAnchors = []string{
+	". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	". IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+// trustAnchors holds the DS trust anchors of each zone.  The anchors of
+// the root zone are replaced by RefreshTrustAnchors while lookups use
+// them.
+type trustAnchors struct {
+	mu      sync.RWMutex
+	anchors map[string][]*dns.DS
+}
+
+// DefaultRootTrustAnchors returns the built-in root zone trust anchors
+// as DS records.
+func DefaultRootTrustAnchors() []*dns.DS {
+	anchors := make([]*dns.DS, 0, len(rootTrustAnchors))
+	for _, s := range rootTrustAnchors {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			panic(err)
+		}
+		anchors = append(anchors, rr.(*dns.DS))
+	}
+	return anchors
+}
+
+// SetRootTrustAnchors replaces the built-in root trust anchors with the
+// supplied DS records.  The root DNSKEY RRset at the top of every
+// authentication chain has to match one of them for the validation
+// to succeed.  Authentication chains use the trust anchors of the
+// package Resolver instance only.
+func (resolver *Resolver) SetRootTrustAnchors(anchors []*dns.DS) error {
+	if len(anchors) < 1 {
+		return ErrInvalidTrustAnchor
+	}
+	for _, ds := range anchors {
+		if ds == nil || ds.Hdr.Name != "." {
+			return ErrInvalidTrustAnchor
+		}
+	}
+	resolver.trustAnchors.mu.Lock()
+	defer resolver.trustAnchors.mu.Unlock()
+	if resolver.trustAnchors.anchors == nil {
+		resolver.trustAnchors.anchors = make(map[string][]*dns.DS)
+	}
+	resolver.trustAnchors.anchors["."] = anchors
+	return nil
+}
+
+// AddTrustAnchor adds a DS or DNSKEY trust anchor for the zone named by
+// the owner name of rr.  Authentication chains stop at the closest
+// zone that has a trust anchor, which allows validating zones that
+// are not delegated from the public root ("islands of security").
+// As with SetRootTrustAnchors, resolver has to be the package Resolver
+// instance.
+func (resolver *Resolver) AddTrustAnchor(rr dns.RR) error {
+	var ds *dns.DS
+	switch t := rr.(type) {
+	case *dns.DS:
+		ds = t
+	case *dns.DNSKEY:
+		if t.Flags&dns.ZONE == 0 || t.Flags&dns.REVOKE != 0 {
+			return ErrInvalidTrustAnchor
+		}
+		ds = t.ToDS(dns.SHA256)
+	}
+	if ds == nil {
+		return ErrInvalidTrustAnchor
+	}
+	zone := canonicalName(ds.Hdr.Name)
+	resolver.trustAnchors.mu.Lock()
+	defer resolver.trustAnchors.mu.Unlock()
+	if resolver.trustAnchors.anchors == nil {
+		resolver.trustAnchors.anchors = make(map[string][]*dns.DS)
+	}
+	// Readers may hold the current slice, so it is never modified.
+	anchors := resolver.trustAnchors.anchors[zone]
+	resolver.trustAnchors.anchors[zone] = append(anchors[:len(anchors):len(anchors)], ds)
+	return nil
+}
+
+// RemoveTrustAnchors removes every trust anchor configured for zone.
+func (resolver *Resolver) RemoveTrustAnchors(zone string) {
+	resolver.trustAnchors.mu.Lock()
+	defer resolver.trustAnchors.mu.Unlock()
+	delete(resolver.trustAnchors.anchors, canonicalName(zone))
+}
+
+// zoneTrustAnchors returns the trust anchors configured for zone.
+func (resolver *Resolver) zoneTrustAnchors(zone string) []*dns.DS {
+	resolver.trustAnchors.mu.RLock()
+	defer resolver.trustAnchors.mu.RUnlock()
+	return resolver.trustAnchors.anchors[canonicalName(zone)]
+}
+
+// hasTrustAnchor returns true if a trust anchor is configured for zone.
+func (resolver *Resolver) hasTrustAnchor(zone string) bool {
+	return len(resolver.zoneTrustAnchors(zone)) > 0
+}
+
+// verifyTrustAnchor validates the DNSKEY RRset of the zone at the top
+// of the authentication chain against the configured trust anchors,
+// the same way a delegation is validated against the DS RRset in
+// the parent zone.  It returns ErrTrustAnchorMismatch if no trust
+// anchor matches a DNSKEY, and the signature error if the matching
+// DNSKEY doesn't sign the DNSKEY RRset.
+func (z SignedZone) verifyTrustAnchor(anchors []*dns.DS) error {
+	if len(anchors) < 1 {
+		return ErrNoTrustAnchor
+	}
+	dsRrset := make([]dns.RR, 0, len(anchors))
+	for _, ds := range anchors {
+		dsRrset = append(dsRrset, ds)
+	}
+	err := z.verifyDS(dsRrset)
+	if err != nil && isDsMismatch(err) {
+		return ErrTrustAnchorMismatch
+	}
+	return err
+}
+
+// ParseBindTrustAnchors reads trust anchors in the format of the BIND
+// configuration statements trust-anchors, managed-keys and
+// trusted-keys.  Both static and initial keys and DS records are
+// returned as static trust anchors.
+//
+//	trust-anchors {
+//		corp.internal. static-key 257 3 13 "mdsswUyr3DPW...";
+//		example.com. static-ds 12345 13 2 "4EBD4D2A8F5...";
+//	};
+//	trusted-keys {
+//		"corp.internal." 257 3 13 "mdsswUyr3DPW...";
+//	};
+func ParseBindTrustAnchors(r io.Reader) ([]dns.RR, error) {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := bindTokens(string(buf))
+	if err != nil {
+		return nil, err
+	}
+
+	anchors := make([]dns.RR, 0)
+	for len(tokens) > 0 {
+		statement := tokens[0]
+		if len(tokens) < 2 || tokens[1] != "{" {
+			return nil, ErrInvalidTrustAnchor
+		}
+		tokens = tokens[2:]
+		for len(tokens) > 0 && tokens[0] != "}" {
+			end := 0
+			for end < len(tokens) && tokens[end] != ";" {
+				end++
+			}
+			if end == len(tokens) {
+				return nil, ErrInvalidTrustAnchor
+			}
+			rr, err := parseBindTrustAnchor(statement, tokens[:end])
+			if err != nil {
+				return nil, err
+			}
+			anchors = append(anchors, rr)
+			tokens = tokens[end+1:]
+		}
+		if len(tokens) < 2 || tokens[1] != ";" {
+			return nil, ErrInvalidTrustAnchor
+		}
+		tokens = tokens[2:]
+	}
+	return anchors, nil
+}
+
+// parseBindTrustAnchor converts a single trust anchor entry of a BIND
+// configuration statement into a DS or DNSKEY record.
+func parseBindTrustAnchor(statement string, fields []string) (dns.RR, error) {
+	if len(fields) < 2 {
+		return nil, ErrInvalidTrustAnchor
+	}
+	name := dns.Fqdn(fields[0])
+	rrType := "DNSKEY"
+
+	switch statement {
+	case "trusted-keys":
+		fields = fields[1:]
+	case "trust-anchors", "managed-keys":
+		switch fields[1] {
+		case "static-key", "initial-key":
+		case "static-ds", "initial-ds":
+			rrType = "DS"
+		default:
+			return nil, ErrInvalidTrustAnchor
+		}
+		fields = fields[2:]
+	default:
+		return nil, ErrInvalidTrustAnchor
+	}
+
+	// The last field (the key or the digest) may have been split into
+	// several strings, or span several lines.
+	if len(fields) < 4 {
+		return nil, ErrInvalidTrustAnchor
+	}
+	keyData := strings.Join(strings.Fields(strings.Join(fields[3:], " ")), "")
+	rdata := strings.Join(fields[:3], " ") + " " + keyData
+	rr, err := dns.NewRR(name + " IN " + rrType + " " + rdata)
+	if err != nil || rr == nil {
+		return nil, ErrInvalidTrustAnchor
+	}
+	return rr, nil
+}
+
+// bindTokens splits a BIND configuration snippet into words, quoted
+// strings and the punctuation characters {, } and ;, skipping comments.
+func bindTokens(s string) ([]string, error) {
+	tokens := make([]string, 0)
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '#' || strings.HasPrefix(s[i:], "//"):
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(s[i:], "/*"):
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				return nil, ErrInvalidTrustAnchor
+			}
+			i += end + 4
+		case c == '{' || c == '}' || c == ';':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"':
+			end := strings.IndexByte(s[i+1:], '"')
+			if end < 0 {
+				return nil, ErrInvalidTrustAnchor
+			}
+			tokens = append(tokens, s[i+1:i+1+end])
+			i += end + 2
+		default:
+			start := i
+			for i < len(s) && !strings.ContainsRune(" \t\n\r{};\"", rune(s[i])) {
+				i++
+			}
+			tokens = append(tokens, s[start:i])
+		}
+	}
+	return tokens, nil
+}
+
+// LoadBindTrustAnchors reads a file of BIND trust-anchors, managed-keys
+// or trusted-keys statements and adds its trust anchors to the resolver.
+func (resolver *Resolver) LoadBindTrustAnchors(fileName string) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	anchors, err := ParseBindTrustAnchors(f)
+	if err != nil {
+		return err
+	}
+	for _, rr := range anchors {
+		if err := resolver.AddTrustAnchor(rr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package goresolver
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func newSignedTestNet(t *testing.T) *testNet {
+	n := newTestNet(t, ".", "org.", "example.org.")
+	n.zones["example.org."].add(t, "www.example.org. 300 IN A 192.0.2.1")
+	return n
+}
+
+func TestDefaultRootTrustAnchors(t *testing.T) {
+	anchors := DefaultRootTrustAnchors()
+	if len(anchors) < 1 {
+		t.Fatal("should return the built-in trust anchors")
+	}
+	if anchors[0].KeyTag != 20326 || anchors[0].Hdr.Name != "." {
+		t.Error("should return the root KSK-2017 DS record")
+	}
+}
+
+func TestRootTrustAnchorValid(t *testing.T) {
+	resolver := newSignedTestNet(t).newResolver()
+	result, err := resolver.LookupIPv4("www.example.org.")
+	if err != nil {
+		t.Error("should validate: ", err)
+	}
+	if len(result.IPs()) != 1 {
+		t.Error("lookup should return results")
+	}
+}
+
+func TestRootTrustAnchorMismatch(t *testing.T) {
+	n := newSignedTestNet(t)
+	resolver := n.newResolver()
+	_ = resolver.SetRootTrustAnchors(DefaultRootTrustAnchors())
+	result, err := resolver.LookupIPv4("www.example.org.")
+	if !errors.Is(err, ErrTrustAnchorMismatch) {
+		t.Error("should return ErrTrustAnchorMismatch")
+	}
+	if len(result.IPs()) > 0 {
+		t.Error("lookup shouldn't return results")
+	}
+}
+
+func TestSetRootTrustAnchorsInvalid(t *testing.T) {
+	n := newSignedTestNet(t)
+	resolver := n.newResolver()
+	ds := n.zones["org."].ksk.ToDS(dns.SHA256)
+	if resolver.SetRootTrustAnchors([]*dns.DS{ds}) != ErrInvalidTrustAnchor {
+		t.Error("should reject non-root trust anchors")
+	}
+	if resolver.SetRootTrustAnchors(nil) != ErrInvalidTrustAnchor {
+		t.Error("should reject an empty trust anchor set")
+	}
+}
+
+func newIslandTestNet(t *testing.T) *testNet {
+	n := newTestNet(t, "corp.internal.")
+	n.zones["corp.internal."].add(t, "intranet.corp.internal. 300 IN A 10.0.0.1")
+	return n
+}
+
+func TestIslandOfSecurityNoTrustAnchor(t *testing.T) {
+	resolver := newIslandTestNet(t).newResolver()
+	result, err := resolver.LookupIPv4("intranet.corp.internal.")
+	if err == nil {
+		t.Error("shouldn't validate without a trust anchor")
+	}
+	if len(result.IPs()) > 0 {
+		t.Error("lookup shouldn't return results")
+	}
+}
+
+func TestIslandOfSecurityDnskeyAnchor(t *testing.T) {
+	n := newIslandTestNet(t)
+	resolver := n.newResolver()
+	if err := resolver.AddTrustAnchor(n.zones["corp.internal."].ksk); err != nil {
+		t.Fatal("shouldn't return err: ", err)
+	}
+	result, err := resolver.LookupIPv4("intranet.corp.internal.")
+	if err != nil {
+		t.Error("should validate: ", err)
+	}
+	if len(result.IPs()) != 1 {
+		t.Error("lookup should return results")
+	}
+}
+
+func TestIslandOfSecurityDsAnchor(t *testing.T) {
+	n := newIslandTestNet(t)
+	resolver := n.newResolver()
+	_ = resolver.AddTrustAnchor(n.zones["corp.internal."].ksk.ToDS(dns.SHA256))
+	if _, err := resolver.LookupIPv4("intranet.corp.internal."); err != nil {
+		t.Error("should validate: ", err)
+	}
+}
+
+func TestIslandOfSecurityWrongAnchor(t *testing.T) {
+	n := newIslandTestNet(t)
+	resolver := n.newResolver()
+	key, _ := n.newKey("corp.internal.", 257)
+	_ = resolver.AddTrustAnchor(key)
+	if _, err := resolver.LookupIPv4("intranet.corp.internal."); !errors.Is(err, ErrTrustAnchorMismatch) {
+		t.Error("should return ErrTrustAnchorMismatch")
+	}
+}
+
+func TestTrustAnchorBelowRoot(t *testing.T) {
+	n := newSignedTestNet(t)
+	island := n.addZone("island.example.org.")
+	island.add(t, "www.island.example.org. 300 IN A 192.0.2.3")
+	n.zones["example.org."].remove("island.example.org.", dns.TypeDS)
+
+	resolver := n.newResolver()
+	if result, _ := resolver.LookupIPv4("www.island.example.org."); result.Status == Secure {
+		t.Error("shouldn't validate without DS")
+	}
+	_ = resolver.AddTrustAnchor(island.ksk)
+	if _, err := resolver.LookupIPv4("www.island.example.org."); err != nil {
+		t.Error("should validate against the closest trust anchor: ", err)
+	}
+}
+
+func TestAddTrustAnchorInvalid(t *testing.T) {
+	n := newIslandTestNet(t)
+	resolver := n.newResolver()
+	if resolver.AddTrustAnchor(n.zones["corp.internal."].rrs[2]) != ErrInvalidTrustAnchor {
+		t.Error("should reject RRs other than DS and DNSKEY")
+	}
+	key, _ := n.newKey("corp.internal.", 0)
+	if resolver.AddTrustAnchor(key) != ErrInvalidTrustAnchor {
+		t.Error("should reject non-zone keys")
+	}
+}
+
+func TestTrustAnchorsZeroResolver(t *testing.T) {
+	resolver := &Resolver{}
+	if err := resolver.SetRootTrustAnchors(DefaultRootTrustAnchors()); err != nil {
+		t.Fatal("shouldn't return err: ", err)
+	}
+	key, _ := newIslandTestNet(t).newKey("corp.internal.", 257)
+	if err := resolver.AddTrustAnchor(key); err != nil {
+		t.Fatal("shouldn't return err: ", err)
+	}
+	if len(resolver.zoneTrustAnchors(".")) != 2 || len(resolver.zoneTrustAnchors("corp.internal.")) != 1 {
+		t.Error("should set the trust anchors of a Resolver not built by NewResolver")
+	}
+}
+
+func TestParseBindTrustAnchors(t *testing.T) {
+	conf := `
+// comment
+trust-anchors {
+	/* the root */
+	. static-ds 20326 8 2 "E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D";
+	corp.internal. initial-key 257 3 13 "mdsswUyr3DPW132mOi8V9xESWE8jTo0d
+		xCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ==";
+};
+# comment
+trusted-keys {
+	"lab.internal." 257 3 13 "mdsswUyr3DPW132mOi8V9xESWE8jTo0dxCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ==";
+};
+`
+	anchors, err := ParseBindTrustAnchors(strings.NewReader(conf))
+	if err != nil {
+		t.Fatal("shouldn't return err: ", err)
+	}
+	if len(anchors) != 3 {
+		t.Fatal("should return 3 trust anchors")
+	}
+	if ds, ok := anchors[0].(*dns.DS); !ok || ds.KeyTag != 20326 || ds.Hdr.Name != "." {
+		t.Error("static-ds not parsed correctly")
+	}
+	if key, ok := anchors[1].(*dns.DNSKEY); !ok || key.Hdr.Name != "corp.internal." || key.Algorithm != 13 {
+		t.Error("initial-key not parsed correctly")
+	}
+	if key, ok := anchors[2].(*dns.DNSKEY); !ok || key.Hdr.Name != "lab.internal." ||
+		key.PublicKey != anchors[1].(*dns.DNSKEY).PublicKey {
+		t.Error("trusted-keys not parsed correctly")
+	}
+}
+
+func TestParseBindTrustAnchorsInvalid(t *testing.T) {
+	confs := []string{
+		`trust-anchors { . static-ds 20326 8 2 "E06D" }`,
+		`trust-anchors { . unknown-key 257 3 8 "AwEAAa"; };`,
+		`options { directory "/var/named"; };`,
+		`trusted-keys { "lab.internal." 257 3 13 "mdss; };`,
+	}
+	for _, conf := range confs {
+		if _, err := ParseBindTrustAnchors(strings.NewReader(conf)); err == nil {
+			t.Errorf("should reject %s", conf)
+		}
+	}
+}
+
+func TestLoadBindTrustAnchors(t *testing.T) {
+	n := newIslandTestNet(t)
+	resolver := n.newResolver()
+	fileName := path.Join(t.TempDir(), "trust-anchors.conf")
+	conf := "trust-anchors {\n\tcorp.internal. static-key " +
+		strings.TrimPrefix(n.zones["corp.internal."].ksk.String(), n.zones["corp.internal."].ksk.Hdr.String()) +
+		";\n};\n"
+	if err := os.WriteFile(fileName, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := resolver.LoadBindTrustAnchors(fileName); err != nil {
+		t.Fatal("shouldn't return err: ", err)
+	}
+	if _, err := resolver.LookupIPv4("intranet.corp.internal."); err != nil {
+		t.Error("should validate: ", err)
+	}
+}
@@ -0,0 +1,82 @@
+package goresolver
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// verifiedTTL returns the TTL of a verified RRset, capped by the original
+// TTL of the RRSIG which verified it and by the time remaining until the
+// RRSIG expires (RFC 4035 section 5.3.3).
+func verifiedTTL(rrSet *RRSet, now time.Time) uint32 {
+	var ttl uint32
+	for i, rr := range rrSet.rrSet {
+		if i == 0 || rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+		}
+	}
+	rrSig := rrSet.verifiedBy
+	if rrSig == nil {
+		return ttl
+	}
+	if rrSig.OrigTtl < ttl {
+		ttl = rrSig.OrigTtl
+	}
+	remaining := signatureTime(rrSig.Expiration, now).Sub(now)
+	if remaining < 0 {
+		remaining = 0
+	}
+	if remaining < time.Duration(ttl)*time.Second {
+		ttl = uint32(remaining / time.Second)
+	}
+	return ttl
+}
+
+// clampTTLs returns copies of the RRs of a verified answer with their TTL
+// capped by verifiedTTL, along with the remaining validity of the answer:
+// the lowest TTL of the answer and of the DNSKEY and DS RRsets of the
+// chain of trust.
+func (authChain *AuthenticationChain) clampTTLs(answer *RRSet) ([]dns.RR, time.Duration) {
+	now := authChain.delegationChain[0].time()
+
+	ttl := verifiedTTL(answer, now)
+	rrs := make([]dns.RR, 0, len(answer.rrSet))
+	for _, rr := range answer.rrSet {
+		rr = dns.Copy(rr)
+		rr.Header().Ttl = ttl
+		rrs = append(rrs, rr)
+	}
+
+	for _, signedZone := range authChain.delegationChain {
+		for _, rrSet := range []*RRSet{signedZone.dnskey, signedZone.ds} {
+			if rrSet.verifiedBy == nil {
+				continue
+			}
+			if chainTTL := verifiedTTL(rrSet, now); chainTTL < ttl {
+				ttl = chainTTL
+			}
+		}
+	}
+	return rrs, time.Duration(ttl) * time.Second
+}
+
+// addVerifiedAnswer adds the RRs of an answer verified with authChain to
+// the result, according to the validation status of the result.  Secure
+// RRs get the TTLs of clampTTLs, the validity of the result is the lowest
+// of its Secure answers, and the result is flagged as a wildcard if one
+// of them was synthesized from a wildcard.
+func (result *Result) addVerifiedAnswer(authChain *AuthenticationChain, answer *RRSet) {
+	if result.Status != Secure {
+		result.RRs = append(result.RRs, answer.rrSet...)
+		return
+	}
+	rrs, validity := authChain.clampTTLs(answer)
+	if len(result.RRs) < 1 || validity < result.Validity {
+		result.Validity = validity
+	}
+	if _, ok := answer.wildcardExpansion(); ok {
+		result.Wildcard = true
+	}
+	result.RRs = append(result.RRs, rrs...)
+}
@@ -0,0 +1,79 @@
+package goresolver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestClampTTLOrigTtl(t *testing.T) {
+	n := newSignedTestNet(t)
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "www.example.org." && qtype == dns.TypeA {
+			a := dns.Copy(msg.Answer[0])
+			a.Header().Ttl = 86400
+			msg.Answer[0] = a
+		}
+	}
+	resolver := n.newResolver()
+
+	result, err := resolver.LookupIPv4("www.example.org.")
+	if err != nil || len(result.RRs) != 1 {
+		t.Fatal("should validate: ", err)
+	}
+	if result.RRs[0].Header().Ttl != 300 {
+		t.Error("TTL should be capped by the original TTL: ", result.RRs[0].Header().Ttl)
+	}
+	if result.Validity != 300*time.Second {
+		t.Error("validity should be the TTL of the answer: ", result.Validity)
+	}
+}
+
+func TestClampTTLExpiration(t *testing.T) {
+	n := newSignedTestNet(t)
+	n.zones["example.org."].expiration = time.Now().Add(100 * time.Second)
+	resolver := n.newResolver()
+
+	result, err := resolver.StrictNSQuery("www.example.org.", dns.TypeA)
+	if err != nil || len(result.RRs) != 1 {
+		t.Fatal("should validate: ", err)
+	}
+	if ttl := result.RRs[0].Header().Ttl; ttl > 100 || ttl < 90 {
+		t.Error("TTL should be capped by the signature expiration: ", ttl)
+	}
+	if result.Validity > 100*time.Second {
+		t.Error("validity should be capped by the signature expiration: ", result.Validity)
+	}
+	if rr := n.zones["example.org."].lookup(t, "www.example.org.", dns.TypeA)[0]; rr.Header().Ttl != 300 {
+		t.Error("the TTL of the zone data shouldn't change: ", rr.Header().Ttl)
+	}
+}
+
+func TestClampTTLChain(t *testing.T) {
+	n := newSignedTestNet(t)
+	n.zones["org."].expiration = time.Now().Add(60 * time.Second)
+	resolver := n.newResolver()
+
+	result, err := resolver.LookupIP("www.example.org.")
+	if err != nil || len(result.RRs) != 1 {
+		t.Fatal("should validate: ", err)
+	}
+	if result.RRs[0].Header().Ttl != 300 {
+		t.Error("TTL of the answer shouldn't change: ", result.RRs[0].Header().Ttl)
+	}
+	if result.Validity > 60*time.Second {
+		t.Error("validity should be capped by the signatures of the chain of trust: ", result.Validity)
+	}
+}
+
+func TestClampTTLInsecure(t *testing.T) {
+	n := newSignedTestNet(t)
+	resolver := n.newResolver()
+	resolver.AddNegativeTrustAnchor("example.org.", time.Now().Add(time.Hour))
+
+	result, _ := resolver.LookupIPv4("www.example.org.")
+	if result.Status != Insecure || result.Validity != 0 {
+		t.Error("validity of insecure answers should be zero: ", result.Validity)
+	}
+}
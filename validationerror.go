@@ -0,0 +1,83 @@
+package goresolver
+
+import (
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// ValidationError describes why an RRset failed DNSSEC validation.  It
+// satisfies errors.Is against the sentinel error in Reason, as well as
+// against the underlying error in Err.
+type ValidationError struct {
+	// Zone is the zone whose RRs failed to validate.
+	Zone string
+	// RRType is the type of the RRset that failed to validate.
+	RRType uint16
+	// KeyTag and Algorithm identify the key of the RRSIG or DS RR
+	// involved, if any.
+	KeyTag    uint16
+	Algorithm uint8
+	// Position is the index of Zone in the delegation chain, starting
+	// with 0 for the zone that signed the answer.
+	Position int
+	// Reason is one of the sentinel errors of the package.
+	Reason error
+	// Err is the underlying cryptographic or validity error, if any.
+	Err error
+}
+
+// newValidationError returns a ValidationError for rrSet in the zone at
+// position in the delegation chain, taking the RR type, key tag and
+// algorithm from the RRSIG of rrSet.
+func newValidationError(reason error, zone string, position int, rrSet *RRSet, err error) *ValidationError {
+	e := &ValidationError{
+		Zone:     zone,
+		Position: position,
+		Reason:   reason,
+		Err:      err,
+	}
+	if rrSet == nil {
+		return e
+	}
+	if len(rrSet.rrSet) > 0 {
+		e.RRType = rrSet.rrSet[0].Header().Rrtype
+	}
+	if rrSet.IsSigned() {
+		e.RRType = rrSet.rrSigs[0].TypeCovered
+		e.KeyTag = rrSet.rrSigs[0].KeyTag
+		e.Algorithm = rrSet.rrSigs[0].Algorithm
+	}
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	s := e.Zone
+	if e.RRType != 0 {
+		s += " " + dns.TypeToString[e.RRType]
+	}
+	if e.KeyTag != 0 || e.Algorithm != 0 {
+		s += fmt.Sprintf(" (key tag %d, algorithm %s)", e.KeyTag, dns.AlgorithmToString[e.Algorithm])
+	}
+	s += ": " + e.Reason.Error()
+	if e.Err != nil && e.Err != e.Reason {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+// ExtendedError returns the Extended DNS Error (RFC 8914) describing the
+// validation failure.
+func (e *ValidationError) ExtendedError() *ExtendedError {
+	return &ExtendedError{InfoCode: extendedErrorCode(e), ExtraText: e.Error()}
+}
+
+// Is reports whether target is the sentinel error in Reason.
+func (e *ValidationError) Is(target error) bool {
+	return target == e.Reason
+}
+
+// Unwrap returns the underlying error.
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,82 @@
+package goresolver
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestValidationErrorAnswer(t *testing.T) {
+	n := newSignedTestNet(t)
+	example := n.zones["example.org."]
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "www.example.org." && qtype == dns.TypeA {
+			a := dns.Copy(msg.Answer[0]).(*dns.A)
+			a.A = net.ParseIP("192.0.2.2")
+			msg.Answer[0] = a
+		}
+	}
+	resolver := n.newResolver()
+
+	_, err := resolver.LookupIPv4("www.example.org.")
+	if !errors.Is(err, ErrInvalidRRsig) {
+		t.Fatal("should return ErrInvalidRRsig: ", err)
+	}
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatal("should return a ValidationError")
+	}
+	if validationErr.Zone != "example.org." || validationErr.RRType != dns.TypeA ||
+		validationErr.Position != 0 {
+		t.Error("should describe the answer RRset: ", validationErr)
+	}
+	if validationErr.KeyTag != example.zsk.KeyTag() || validationErr.Algorithm != example.zsk.Algorithm {
+		t.Error("should describe the signing key: ", validationErr)
+	}
+	if validationErr.Err == nil {
+		t.Error("should hold the underlying error")
+	}
+}
+
+func TestValidationErrorExpired(t *testing.T) {
+	resolver := newBrokenTestNet(t).newResolver()
+
+	_, err := resolver.LookupIPv4("www.example.org.")
+	if !errors.Is(err, ErrInvalidRRsig) || !errors.Is(err, ErrRrsigValidityPeriod) {
+		t.Error("should return ErrInvalidRRsig caused by ErrRrsigValidityPeriod: ", err)
+	}
+}
+
+func TestValidationErrorChainPosition(t *testing.T) {
+	n := newBrokenTestNet(t)
+	resolver := n.newResolver()
+
+	_, err := resolver.LookupIPv4("www.other.org.")
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) || !errors.Is(err, ErrDsInvalid) {
+		t.Fatal("should return a ValidationError for ErrDsInvalid: ", err)
+	}
+	if validationErr.Zone != "other.org." || validationErr.RRType != dns.TypeDS ||
+		validationErr.Position != 0 {
+		t.Error("should describe the DS RRset: ", validationErr)
+	}
+
+	org := n.zones["org."]
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "org." && qtype == dns.TypeDNSKEY {
+			// Sign only part of the DNSKEY RRset.
+			last := len(msg.Answer) - 1
+			msg.Answer[last] = org.sign(t, msg.Answer[:1], org.ksk, org.kskSigner)
+		}
+	}
+	_, err = resolver.LookupIPv4("www.other.org.")
+	if !errors.As(err, &validationErr) || !errors.Is(err, ErrRrsigValidationError) {
+		t.Fatal("should return a ValidationError for ErrRrsigValidationError: ", err)
+	}
+	if validationErr.Zone != "org." || validationErr.RRType != dns.TypeDNSKEY ||
+		validationErr.Position != 1 {
+		t.Error("should describe the DNSKEY RRset of org.: ", validationErr)
+	}
+}
@@ -0,0 +1,102 @@
+package goresolver
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// synthesizeWildcard makes the name server answer A queries for qname
+// with the signed RRs of *.example.org., along with the denial records
+// proving denied, if any.
+func synthesizeWildcard(t *testing.T, n *testNet, qname string, denied ...string) {
+	example := n.zones["example.org."]
+	example.add(t, "*.example.org. 300 IN A 192.0.2.9")
+	n.tamper = func(name string, qtype uint16, msg *dns.Msg) {
+		if name != qname || qtype != dns.TypeA {
+			return
+		}
+		msg.Rcode = dns.RcodeSuccess
+		msg.Answer = nil
+		for _, rr := range example.lookup(t, "*.example.org.", dns.TypeA) {
+			rr = dns.Copy(rr)
+			rr.Header().Name = qname
+			msg.Answer = append(msg.Answer, rr)
+		}
+		msg.Ns = nil
+		if len(denied) > 0 {
+			msg.Ns = example.denial(t, denied...)
+		}
+	}
+}
+
+func TestWildcardExpansion(t *testing.T) {
+	n := newSignedTestNet(t)
+	synthesizeWildcard(t, n, "foo.example.org.", "foo.example.org.")
+	resolver := n.newResolver()
+
+	result, err := resolver.LookupIPv4("foo.example.org.")
+	if err != nil || result.Status != Secure {
+		t.Fatal("proven wildcard expansion should validate: ", err)
+	}
+	if !result.Wildcard || len(result.RRs) != 1 || result.RRs[0].Header().Name != "foo.example.org." {
+		t.Error("result should hold the synthesized RRs and be flagged: ", result.RRs)
+	}
+
+	result, err = resolver.LookupIPv4("www.example.org.")
+	if err != nil || result.Wildcard {
+		t.Error("answer shouldn't be flagged as synthesized: ", err)
+	}
+}
+
+func TestWildcardExpansionNSEC3(t *testing.T) {
+	n := newNSEC3TestNet(t)
+	synthesizeWildcard(t, n, "foo.example.org.", "foo.example.org.")
+	resolver := n.newResolver()
+
+	result, err := resolver.StrictNSQuery("foo.example.org.", dns.TypeA)
+	if err != nil || !result.Wildcard {
+		t.Error("wildcard expansion proven by NSEC3 should validate: ", err)
+	}
+}
+
+func TestWildcardExpansionWithoutProof(t *testing.T) {
+	n := newSignedTestNet(t)
+	synthesizeWildcard(t, n, "foo.example.org.")
+	resolver := n.newResolver()
+
+	result, err := resolver.LookupIPv4("foo.example.org.")
+	if !errors.Is(err, ErrNoDenialProof) || len(result.RRs) > 0 {
+		t.Error("wildcard expansion without denial records shouldn't validate: ", err)
+	}
+}
+
+func TestWildcardExpansionCloserMatch(t *testing.T) {
+	n := newSignedTestNet(t)
+	// www.example.org. exists, so the answer can't come from *.example.org.
+	synthesizeWildcard(t, n, "foo.www.example.org.", "foo.www.example.org.")
+	resolver := n.newResolver()
+
+	_, err := resolver.LookupIPv4("foo.www.example.org.")
+	if !errors.Is(err, ErrNoDenialProof) {
+		t.Error("wildcard expansion with a closer match shouldn't validate: ", err)
+	}
+}
+
+func TestRrsigLabelsExceedOwner(t *testing.T) {
+	n := newSignedTestNet(t)
+	n.tamper = func(qname string, qtype uint16, msg *dns.Msg) {
+		if qname == "www.example.org." && qtype == dns.TypeA {
+			sig := dns.Copy(msg.Answer[1]).(*dns.RRSIG)
+			sig.Labels = 4
+			msg.Answer[1] = sig
+		}
+	}
+	resolver := n.newResolver()
+
+	_, err := resolver.LookupIPv4("www.example.org.")
+	if !errors.Is(err, ErrInvalidRrsigLabels) {
+		t.Error("should return ErrInvalidRrsigLabels: ", err)
+	}
+}